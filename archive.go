@@ -0,0 +1,115 @@
+package configurer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+const archiveMemberSep = "!/"
+
+// ArchiveSource reads a config file from inside a local .tar, .tar.gz, .tgz
+// or .zip archive. The member is given after a !/ separator, e.g.
+// archive:///srv/bundle.tar.gz!/config/app.toml, and the unmarshaller is
+// picked from the member's extension.
+type ArchiveSource struct {
+}
+
+func (a *ArchiveSource) Protocols() []string {
+	return []string{"archive"}
+}
+
+func (a *ArchiveSource) Reader(url string) (io.ReadCloser, error) {
+	location := strings.TrimPrefix(url, "archive://")
+	sepIdx := strings.Index(location, archiveMemberSep)
+	if sepIdx == -1 {
+		return nil, errors.New("archive url should contain the member to read after !/")
+	}
+	archivePath := location[:sepIdx]
+	member := cleanArchiveName(location[sepIdx+len(archiveMemberSep):])
+
+	var data []byte
+	var err error
+	switch {
+	case strings.HasSuffix(archivePath, ".zip"):
+		data, err = a.readZip(archivePath, member)
+	case strings.HasSuffix(archivePath, ".tar.gz"), strings.HasSuffix(archivePath, ".tgz"):
+		data, err = a.readTar(archivePath, member, true)
+	case strings.HasSuffix(archivePath, ".tar"):
+		data, err = a.readTar(archivePath, member, false)
+	default:
+		return nil, fmt.Errorf("unsupported archive type for %s", archivePath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (a *ArchiveSource) readZip(archivePath string, member string) ([]byte, error) {
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "error opening archive")
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		if cleanArchiveName(f.Name) != member {
+			continue
+		}
+		rd, err := f.Open()
+		if err != nil {
+			return nil, errors.Wrap(err, "error opening archive member")
+		}
+		defer rd.Close()
+		return ioutil.ReadAll(rd)
+	}
+	return nil, fmt.Errorf("archive %s does not contain %s", archivePath, member)
+}
+
+func (a *ArchiveSource) readTar(archivePath string, member string, gzipped bool) ([]byte, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "error opening archive")
+	}
+	defer f.Close()
+
+	var rd io.Reader = f
+	if gzipped {
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, errors.Wrap(err, "error decompressing archive")
+		}
+		defer gr.Close()
+		rd = gr
+	}
+
+	tr := tar.NewReader(rd)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("archive %s does not contain %s", archivePath, member)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading archive")
+		}
+		if hdr.Typeflag != tar.TypeReg || cleanArchiveName(hdr.Name) != member {
+			continue
+		}
+		return ioutil.ReadAll(tr)
+	}
+}
+
+// cleanArchiveName normalizes member names so that ./config/app.toml and
+// /config/app.toml both match config/app.toml.
+func cleanArchiveName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
@@ -0,0 +1,81 @@
+package configurer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArchiveSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configurer_")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"README.md":       "not a config",
+		"config/app.toml": "name = \"app\"\nport = 8080\n",
+	}
+
+	writeTar := func(w io.Writer) {
+		tw := tar.NewWriter(w)
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: "./config/", Typeflag: tar.TypeDir, Mode: 0755}))
+		for _, name := range []string{"README.md", "config/app.toml"} {
+			require.NoError(t, tw.WriteHeader(&tar.Header{Name: "./" + name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(files[name]))}))
+			_, err := tw.Write([]byte(files[name]))
+			require.NoError(t, err)
+		}
+		require.NoError(t, tw.Close())
+	}
+
+	tarFile, err := os.Create(filepath.Join(dir, "bundle.tar"))
+	require.NoError(t, err)
+	writeTar(tarFile)
+	require.NoError(t, tarFile.Close())
+
+	tgzFile, err := os.Create(filepath.Join(dir, "bundle.tar.gz"))
+	require.NoError(t, err)
+	gw := gzip.NewWriter(tgzFile)
+	writeTar(gw)
+	require.NoError(t, gw.Close())
+	require.NoError(t, tgzFile.Close())
+
+	zipFile, err := os.Create(filepath.Join(dir, "bundle.zip"))
+	require.NoError(t, err)
+	zw := zip.NewWriter(zipFile)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	require.NoError(t, zipFile.Close())
+
+	type cfg struct {
+		Name string `toml:"name" config:"required"`
+		Port int    `toml:"port"`
+	}
+
+	for _, archive := range []string{"bundle.tar", "bundle.tar.gz", "bundle.zip"} {
+		url := fmt.Sprintf("archive://%s!/config/app.toml", filepath.Join(dir, archive))
+		actCfg := new(cfg)
+		require.NoError(t, LoadURL(url, actCfg), url)
+		require.Equal(t, "app", actCfg.Name, url)
+		require.Equal(t, 8080, actCfg.Port, url)
+
+		_, err := new(ArchiveSource).Reader(fmt.Sprintf("archive://%s!/config/missing.toml", filepath.Join(dir, archive)))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "does not contain config/missing.toml")
+	}
+
+	_, err = new(ArchiveSource).Reader(fmt.Sprintf("archive://%s", filepath.Join(dir, "bundle.zip")))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "should contain the member to read")
+}
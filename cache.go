@@ -0,0 +1,158 @@
+package configurer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// committer is implemented by sources that want to know when the payload
+// they last returned for a URL was loaded and validated successfully, along
+// with the sidecar files it was verified against.
+type committer interface {
+	commit(url string, sidecars []string)
+}
+
+// CachingSource wraps another source and keeps a copy of the last payload
+// that was loaded and validated successfully in a local directory. If the
+// underlying source fails, the cached copy is served instead, so services can
+// still start while their config server is down. Cached copies of a
+// SyntheticSource payload are verified as a whole, even if the underlying
+// source verifies each of its parts.
+type CachingSource struct {
+	Source Source
+	// Dir is the directory cached payloads are stored in. It's created if it
+	// doesn't exist.
+	Dir string
+	// MaxAge is how old a cached payload can be before it's no longer used as
+	// a fallback. Zero means no limit.
+	MaxAge time.Duration
+	// OnFallback is called whenever a cached payload is served because the
+	// underlying source failed with err.
+	OnFallback func(url string, err error, age time.Duration)
+	// OnCacheError is called when a validated payload can't be written to
+	// the cache. Such errors don't fail the load.
+	OnCacheError func(url string, err error)
+
+	mtx     sync.Mutex
+	pending map[string][]byte
+}
+
+func (c *CachingSource) Protocols() []string {
+	return c.Source.Protocols()
+}
+
+func (c *CachingSource) Format(url string) Unmarshaller {
+	if formatSource, ok := c.Source.(FormatSource); ok {
+		return formatSource.Format(url)
+	}
+	return nil
+}
+
+func (c *CachingSource) Synthetic(url string) bool {
+	if syntheticSource, ok := c.Source.(SyntheticSource); ok {
+		return syntheticSource.Synthetic(url)
+	}
+	return false
+}
+
+func (c *CachingSource) Watch(ctx context.Context, url string) error {
+	if watcher, ok := c.Source.(Watcher); ok {
+		return watcher.Watch(ctx, url)
+	}
+	return errWatchUnsupported
+}
+
+func (c *CachingSource) Reader(url string) (io.ReadCloser, error) {
+	rd, err := c.Source.Reader(url)
+	if err != nil {
+		return c.fallback(url, err)
+	}
+	buf, err := ioutil.ReadAll(rd)
+	rd.Close()
+	if err != nil {
+		return c.fallback(url, errors.Wrap(err, "error reading config"))
+	}
+
+	c.mtx.Lock()
+	if c.pending == nil {
+		c.pending = make(map[string][]byte)
+	}
+	c.pending[url] = buf
+	c.mtx.Unlock()
+	return ioutil.NopCloser(bytes.NewReader(buf)), nil
+}
+
+func (c *CachingSource) fallback(url string, err error) (io.ReadCloser, error) {
+	path := c.path(url)
+	info, statErr := os.Stat(path)
+	if statErr != nil {
+		return nil, err
+	}
+	age := time.Since(info.ModTime())
+	if c.MaxAge > 0 && age > c.MaxAge {
+		return nil, errors.Wrap(err, fmt.Sprintf("cached config is too old to fall back to (%s)", age.Round(time.Second)))
+	}
+	buf, readErr := ioutil.ReadFile(path)
+	if readErr != nil {
+		return nil, err
+	}
+	if c.OnFallback != nil {
+		c.OnFallback(url, err, age)
+	}
+	return ioutil.NopCloser(bytes.NewReader(buf)), nil
+}
+
+func (c *CachingSource) commit(url string, sidecars []string) {
+	if inner, ok := c.Source.(committer); ok {
+		inner.commit(url, sidecars)
+	}
+
+	// Sidecars are cached along with the payload, so that a cached payload
+	// can still be verified while the underlying source is down.
+	for _, cached := range append([]string{url}, sidecars...) {
+		c.mtx.Lock()
+		buf, ok := c.pending[cached]
+		delete(c.pending, cached)
+		c.mtx.Unlock()
+		if !ok {
+			continue
+		}
+		if err := c.write(cached, buf); err != nil && c.OnCacheError != nil {
+			c.OnCacheError(cached, err)
+		}
+	}
+}
+
+func (c *CachingSource) write(url string, buf []byte) error {
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		return errors.Wrap(err, "error creating cache dir")
+	}
+	tmp, err := ioutil.TempFile(c.Dir, ".configurer_")
+	if err != nil {
+		return errors.Wrap(err, "error creating cache file")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "error writing cache file")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "error writing cache file")
+	}
+	return os.Rename(tmp.Name(), c.path(url))
+}
+
+func (c *CachingSource) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.Dir, hex.EncodeToString(sum[:]))
+}
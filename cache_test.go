@@ -0,0 +1,99 @@
+package configurer
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCachingSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configurer_")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	type cfg struct {
+		Name string `config:"required"`
+	}
+
+	mem := NewMemorySource()
+	var fallbacks int
+	source := &CachingSource{
+		Source: mem,
+		Dir:    filepath.Join(dir, "cache"),
+		MaxAge: time.Hour,
+		OnFallback: func(url string, err error, age time.Duration) {
+			require.Equal(t, "mem://app.json", url)
+			require.Contains(t, err.Error(), "no config registered under app.json")
+			fallbacks++
+		},
+		OnCacheError: func(url string, err error) {
+			require.NoError(t, err)
+		},
+	}
+	loader := NewLoader()
+	loader.RegisterSource(source)
+	loader.RegisterUnmarshaller(DefaultJSONUnmarshaller)
+
+	err = loader.LoadURL("mem://app.json", new(cfg))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no config registered under app.json")
+
+	mem.Set("app.json", []byte(`{"Name": "cached"}`))
+	actCfg := new(cfg)
+	require.NoError(t, loader.LoadURL("mem://app.json", actCfg))
+	require.Equal(t, "cached", actCfg.Name)
+
+	// invalid payloads are never cached
+	mem.Set("app.json", []byte(`{"Name": ""}`))
+	require.Error(t, loader.LoadURL("mem://app.json", new(cfg)))
+
+	mem.Delete("app.json")
+	actCfg = new(cfg)
+	require.NoError(t, loader.LoadURL("mem://app.json", actCfg))
+	require.Equal(t, "cached", actCfg.Name)
+	require.Equal(t, 1, fallbacks)
+
+	old := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(source.path("mem://app.json"), old, old))
+	err = loader.LoadURL("mem://app.json", new(cfg))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "cached config is too old to fall back to")
+	require.Equal(t, 1, fallbacks)
+}
+
+func TestCachingSource_Sidecars(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configurer_")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	payload := []byte(`{"Name": "signed"}`)
+	mem := NewMemorySource()
+	mem.Set("app.json", payload)
+	mem.Set("app.json.sig", ed25519.Sign(priv, payload))
+
+	source := &CachingSource{
+		Source: mem,
+		Dir:    dir,
+	}
+	loader := NewLoader()
+	loader.RegisterSource(source)
+	loader.RegisterUnmarshaller(DefaultJSONUnmarshaller)
+	loader.RegisterVerifier(&SignatureVerifier{PublicKeys: []ed25519.PublicKey{pub}})
+
+	require.NoError(t, loader.LoadURL("mem://app.json", new(verifyTestConfig)))
+	require.Empty(t, source.pending)
+
+	// The cached payload can still be verified once the source is gone.
+	mem.Delete("app.json")
+	mem.Delete("app.json.sig")
+	actCfg := new(verifyTestConfig)
+	require.NoError(t, loader.LoadURL("mem://app.json", actCfg))
+	require.Equal(t, "signed", actCfg.Name)
+}
@@ -0,0 +1,71 @@
+package configurer
+
+import (
+	"compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"strings"
+)
+
+// Decompressor decompresses config payloads whose URL ends in one of its
+// extensions. The extension is stripped before the unmarshaller is picked,
+// so routes.json.gz is decompressed and then decoded as JSON.
+type Decompressor interface {
+	Extensions() []string
+	Decompress(r io.Reader) (io.ReadCloser, error)
+}
+
+type GzipDecompressor struct {
+}
+
+var DefaultGzipDecompressor = new(GzipDecompressor)
+
+func (g *GzipDecompressor) Extensions() []string {
+	return []string{"gz"}
+}
+
+func (g *GzipDecompressor) Decompress(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+type ZstdDecompressor struct {
+}
+
+var DefaultZstdDecompressor = new(ZstdDecompressor)
+
+func (z *ZstdDecompressor) Extensions() []string {
+	return []string{"zst"}
+}
+
+func (z *ZstdDecompressor) Decompress(r io.Reader) (io.ReadCloser, error) {
+	dec, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return dec.IOReadCloser(), nil
+}
+
+// decompressorFor returns the decompressor registered for url's extension,
+// along with url stripped of that extension. If there is none, url is
+// returned as-is. As with unmarshallers, the extension is taken from the
+// path, ignoring any query string.
+func (l *Loader) decompressorFor(url string) (string, Decompressor) {
+	pathEnd := len(url)
+	if queryIdx := strings.Index(url, "?"); queryIdx != -1 && !strings.Contains(url[queryIdx:], "#") {
+		pathEnd = queryIdx
+	}
+	extIdx := strings.LastIndex(url[:pathEnd], ".")
+	if extIdx == -1 {
+		return url, nil
+	}
+	decompressor := l.decompressors[url[extIdx+1:pathEnd]]
+	if decompressor == nil {
+		return url, nil
+	}
+	return url[:extIdx] + url[pathEnd:], decompressor
+}
+
+func init() {
+	RegisterDecompressor(DefaultGzipDecompressor)
+	RegisterDecompressor(DefaultZstdDecompressor)
+}
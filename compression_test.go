@@ -0,0 +1,55 @@
+package configurer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestLoad_Compressed(t *testing.T) {
+	payload := []byte(`{"Routes": [{"Path": "/a", "Backend": "one"}, {"Path": "/b", "Backend": "two"}]}`)
+
+	var gzipped bytes.Buffer
+	gw := gzip.NewWriter(&gzipped)
+	_, err := gw.Write(payload)
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+
+	var zstded bytes.Buffer
+	zw, err := zstd.NewWriter(&zstded)
+	require.NoError(t, err)
+	_, err = zw.Write(payload)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	DefaultMemorySource.Set("routes.json.gz", gzipped.Bytes())
+	DefaultMemorySource.Set("routes.json.zst", zstded.Bytes())
+	DefaultMemorySource.Set("corrupt.json.gz", payload)
+	defer DefaultMemorySource.Delete("routes.json.gz")
+	defer DefaultMemorySource.Delete("routes.json.zst")
+	defer DefaultMemorySource.Delete("corrupt.json.gz")
+
+	type cfg struct {
+		Routes []struct {
+			Path    string `config:"required"`
+			Backend string `config:"required"`
+		} `config:"required"`
+	}
+
+	gzipDigest := fmt.Sprintf("%x", sha256.Sum256(gzipped.Bytes()))
+	for _, url := range []string{"mem://routes.json.gz", "mem://routes.json.zst", "mem://routes.json.gz#sha256=" + gzipDigest} {
+		actCfg := new(cfg)
+		require.NoError(t, LoadURL(url, actCfg), url)
+		require.Len(t, actCfg.Routes, 2, url)
+		require.Equal(t, "/a", actCfg.Routes[0].Path, url)
+		require.Equal(t, "two", actCfg.Routes[1].Backend, url)
+	}
+
+	err = LoadURL("mem://corrupt.json.gz", new(cfg))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "error decompressing config")
+}
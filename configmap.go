@@ -0,0 +1,178 @@
+package configurer
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const configMapDataDir = "..data"
+
+// ConfigMapSource reads a Kubernetes ConfigMap or Secret mounted as a volume,
+// e.g. configmap:///etc/myapp/config. Each file in the volume holds the value
+// of a single key, and file names are split into nested keys by Separator.
+// A single trailing newline is trimmed from each value, unless it isn't valid
+// UTF-8, in which case it's kept byte for byte for []byte fields.
+//
+// Kubernetes updates mounted volumes by atomically swapping the ..data
+// symlink to a new directory. Reader resolves the symlink once so that all
+// keys come from the same revision, and Watch reports a change whenever the
+// symlink's target changes. Directories without the symlink can be read but
+// not watched.
+type ConfigMapSource struct {
+	// Separator splits file names into nested keys, so that a file named
+	// database.host populates the Host field of the Database struct.
+	// Defaults to ".".
+	Separator string
+	// PollInterval is how often Watch checks the ..data symlink. Defaults to
+	// five seconds.
+	PollInterval time.Duration
+
+	mtx       sync.Mutex
+	revisions map[string]string
+}
+
+func (c *ConfigMapSource) Protocols() []string {
+	return []string{"configmap", "secret"}
+}
+
+func (c *ConfigMapSource) Format(url string) Unmarshaller {
+	return DefaultKeyMapUnmarshaller
+}
+
+func (c *ConfigMapSource) Synthetic(url string) bool {
+	return true
+}
+
+func (c *ConfigMapSource) Reader(url string) (io.ReadCloser, error) {
+	dir := c.dir(url)
+	revision, err := c.revision(dir)
+	if err != nil {
+		return nil, err
+	}
+	dataDir := dir
+	if revision != "" {
+		dataDir = filepath.Join(dir, revision)
+	}
+
+	infos, err := ioutil.ReadDir(dataDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading volume")
+	}
+
+	separator := c.Separator
+	if separator == "" {
+		separator = "."
+	}
+
+	keyMap := make(map[string]interface{})
+	for _, info := range infos {
+		name := info.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		path := filepath.Join(dataDir, name)
+		stat, err := os.Stat(path)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("error reading key %s", name))
+		}
+		if stat.IsDir() {
+			continue
+		}
+		value, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("error reading key %s", name))
+		}
+		setKeyMapPath(keyMap, strings.Split(name, separator), configMapValue(value))
+	}
+
+	c.mtx.Lock()
+	if c.revisions == nil {
+		c.revisions = make(map[string]string)
+	}
+	c.revisions[url] = revision
+	c.mtx.Unlock()
+
+	return encodeKeyMap(keyMap)
+}
+
+func (c *ConfigMapSource) Watch(ctx context.Context, url string) error {
+	dir := c.dir(url)
+	c.mtx.Lock()
+	last, ok := c.revisions[url]
+	c.mtx.Unlock()
+	if !ok {
+		var err error
+		if last, err = c.revision(dir); err != nil {
+			return err
+		}
+	}
+	if last == "" {
+		return errors.Wrap(errWatchUnsupported, "volume has no ..data symlink to watch")
+	}
+
+	interval := c.PollInterval
+	if interval == 0 {
+		interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		revision, err := c.revision(dir)
+		if err != nil {
+			return err
+		}
+		if revision != last {
+			return nil
+		}
+	}
+}
+
+func (c *ConfigMapSource) dir(url string) string {
+	for _, proto := range c.Protocols() {
+		url = strings.TrimPrefix(url, proto+"://")
+	}
+	return url
+}
+
+// configMapValue returns the key map value for a file's contents. Values that
+// aren't valid UTF-8, such as binary keys in Secrets, can't survive being
+// encoded as JSON strings, so they're kept as a list of bytes instead, which
+// populates []byte fields unchanged.
+func configMapValue(value []byte) interface{} {
+	if !utf8.Valid(value) {
+		bytes := make([]interface{}, len(value))
+		for i, b := range value {
+			bytes[i] = b
+		}
+		return bytes
+	}
+	return strings.TrimSuffix(string(value), "\n")
+}
+
+// revision returns the target of the volume's ..data symlink, or an empty
+// string if the directory wasn't mounted by Kubernetes.
+func (c *ConfigMapSource) revision(dir string) (string, error) {
+	target, err := os.Readlink(filepath.Join(dir, configMapDataDir))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "error reading ..data symlink")
+	}
+	return target, nil
+}
@@ -0,0 +1,189 @@
+package configurer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConsulSource reads configs from a Consul-compatible KV HTTP API. A URL
+// naming a single key, e.g. consul://127.0.0.1:8500/service/app/config.yaml,
+// reads that key as a config file whose format is taken from its extension.
+// A URL ending in a slash, e.g. consul://127.0.0.1:8500/service/app/, reads
+// every key under the prefix as a tree: key paths below the prefix become
+// nested keys, so service/app/database/host populates the Host field of the
+// Database struct. Trees are decoded by DefaultKeyMapUnmarshaller.
+//
+// Watch uses Consul's blocking queries to wait for changes.
+type ConsulSource struct {
+	// Scheme is used to reach Consul. Defaults to http.
+	Scheme string
+	// Token is sent in the X-Consul-Token header if set.
+	Token string
+	// Client is used to make requests. Defaults to http.DefaultClient.
+	Client *http.Client
+	// WaitTime is how long each blocking query waits for a change before
+	// Consul returns and Watch queries again. Defaults to five minutes.
+	WaitTime time.Duration
+
+	mtx     sync.Mutex
+	indexes map[string]uint64
+}
+
+type consulKVPair struct {
+	Key   string
+	Value []byte
+}
+
+func (c *ConsulSource) Protocols() []string {
+	return []string{"consul"}
+}
+
+func (c *ConsulSource) Format(url string) Unmarshaller {
+	if strings.HasSuffix(url, "/") {
+		return DefaultKeyMapUnmarshaller
+	}
+	return nil
+}
+
+func (c *ConsulSource) Synthetic(url string) bool {
+	return strings.HasSuffix(url, "/")
+}
+
+func (c *ConsulSource) Reader(url string) (io.ReadCloser, error) {
+	body, index, err := c.get(context.Background(), url, 0)
+	if err != nil {
+		return nil, err
+	}
+	c.mtx.Lock()
+	if c.indexes == nil {
+		c.indexes = make(map[string]uint64)
+	}
+	c.indexes[url] = index
+	c.mtx.Unlock()
+
+	if !strings.HasSuffix(url, "/") {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+
+	var pairs []consulKVPair
+	if err := json.Unmarshal(body, &pairs); err != nil {
+		return nil, errors.Wrap(err, "error decoding Consul response")
+	}
+	_, prefix := c.location(url)
+	keyMap := make(map[string]interface{})
+	for _, pair := range pairs {
+		rel := strings.Trim(strings.TrimPrefix(pair.Key, prefix), "/")
+		if rel == "" || strings.HasSuffix(pair.Key, "/") {
+			continue
+		}
+		setKeyMapPath(keyMap, strings.Split(rel, "/"), string(pair.Value))
+	}
+	return encodeKeyMap(keyMap)
+}
+
+func (c *ConsulSource) Watch(ctx context.Context, url string) error {
+	c.mtx.Lock()
+	last, ok := c.indexes[url]
+	c.mtx.Unlock()
+	if !ok {
+		_, index, err := c.get(ctx, url, 0)
+		if err != nil {
+			return err
+		}
+		last = index
+	}
+
+	for {
+		_, index, err := c.get(ctx, url, last)
+		if err != nil {
+			return err
+		}
+		if index != last {
+			return nil
+		}
+	}
+}
+
+// get queries the KV endpoint behind url. If index is non-zero, the query
+// blocks until Consul's index for the key moves past it or the wait time
+// elapses.
+func (c *ConsulSource) get(ctx context.Context, rawURL string, index uint64) ([]byte, uint64, error) {
+	host, key := c.location(rawURL)
+	scheme := c.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	query := make(url.Values)
+	if strings.HasSuffix(rawURL, "/") {
+		query.Set("recurse", "")
+	} else {
+		query.Set("raw", "")
+	}
+	if index > 0 {
+		waitTime := c.WaitTime
+		if waitTime == 0 {
+			waitTime = 5 * time.Minute
+		}
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", fmt.Sprintf("%dms", waitTime.Milliseconds()))
+	}
+	reqURL := fmt.Sprintf("%s://%s/v1/kv/%s?%s", scheme, host, key, query.Encode())
+
+	req, err := http.NewRequest(http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "error creating request")
+	}
+	req = req.WithContext(ctx)
+	if c.Token != "" {
+		req.Header.Set("X-Consul-Token", c.Token)
+	}
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "error querying Consul")
+	}
+	defer res.Body.Close()
+
+	newIndex, _ := strconv.ParseUint(res.Header.Get("X-Consul-Index"), 10, 64)
+	if res.StatusCode == http.StatusNotFound {
+		if index > 0 {
+			return nil, newIndex, nil
+		}
+		return nil, 0, fmt.Errorf("key %s not found in Consul", key)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, 0, &StatusError{
+			StatusCode: res.StatusCode,
+		}
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "error reading Consul response")
+	}
+	return body, newIndex, nil
+}
+
+func (c *ConsulSource) location(url string) (string, string) {
+	location := strings.TrimPrefix(url, "consul://")
+	slashIdx := strings.Index(location, "/")
+	if slashIdx == -1 {
+		return location, ""
+	}
+	return location[:slashIdx], location[slashIdx+1:]
+}
@@ -0,0 +1,183 @@
+package configurer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeConsul struct {
+	mtx     sync.Mutex
+	kv      map[string][]byte
+	index   uint64
+	changed chan struct{}
+}
+
+func newFakeConsul() *fakeConsul {
+	return &fakeConsul{
+		kv:      make(map[string][]byte),
+		index:   1,
+		changed: make(chan struct{}),
+	}
+}
+
+func (f *fakeConsul) set(key string, value string) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.kv[key] = []byte(value)
+	f.index++
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Consul-Token") != "secret" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	query := r.URL.Query()
+
+	f.mtx.Lock()
+	if minIndex, err := strconv.ParseUint(query.Get("index"), 10, 64); err == nil && minIndex >= f.index {
+		wait, err := time.ParseDuration(query.Get("wait"))
+		if err != nil {
+			wait = 5 * time.Minute
+		}
+		changed := f.changed
+		f.mtx.Unlock()
+		select {
+		case <-changed:
+		case <-time.After(wait):
+		case <-r.Context().Done():
+		}
+		f.mtx.Lock()
+	}
+	defer f.mtx.Unlock()
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+
+	if _, ok := query["recurse"]; ok {
+		var keys []string
+		for k := range f.kv {
+			if strings.HasPrefix(k, key) {
+				keys = append(keys, k)
+			}
+		}
+		if len(keys) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		sort.Strings(keys)
+		var pairs []consulKVPair
+		for _, k := range keys {
+			pairs = append(pairs, consulKVPair{Key: k, Value: f.kv[k]})
+		}
+		json.NewEncoder(w).Encode(pairs)
+		return
+	}
+
+	value, ok := f.kv[key]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Write(value)
+}
+
+func TestConsulSource(t *testing.T) {
+	consul := newFakeConsul()
+	consul.set("service/app/name", "app")
+	consul.set("service/app/database/host", "db.internal")
+	consul.set("service/app/database/port", "6543")
+	consul.set("service/app/hosts/0", "a")
+	consul.set("service/app/hosts/1", "b")
+	consul.set("service/app/labels/Team", "payments")
+	consul.set("service/other/name", "other")
+	consul.set("service/app.yaml", "name: blob\ndatabase:\n  host: blob.internal\n")
+	ts := httptest.NewServer(consul)
+	defer ts.Close()
+	host := strings.TrimPrefix(ts.URL, "http://")
+
+	source := &ConsulSource{
+		Token:    "secret",
+		WaitTime: time.Second,
+	}
+	loader := NewLoader()
+	loader.RegisterSource(source)
+	loader.RegisterUnmarshaller(DefaultYAMLUnmarshaller)
+
+	type cfg struct {
+		Name     string `config:"required"`
+		Port     int    `config:"default=8080"`
+		Database struct {
+			Host string `config:"required"`
+			Port int
+		}
+		Hosts  []string
+		Labels map[string]string
+	}
+
+	actCfg := new(cfg)
+	require.NoError(t, loader.LoadURL(fmt.Sprintf("consul://%s/service/app.yaml", host), actCfg))
+	require.Equal(t, "blob", actCfg.Name)
+	require.Equal(t, 8080, actCfg.Port)
+
+	err := loader.LoadURL(fmt.Sprintf("consul://%s/service/missing.yaml", host), new(cfg))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "key service/missing.yaml not found in Consul")
+
+	treeURL := fmt.Sprintf("consul://%s/service/app/", host)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	actCfg = new(cfg)
+	type reload struct {
+		cfg *cfg
+		err error
+	}
+	reloads := make(chan reload)
+	done := make(chan error)
+	go func() {
+		done <- loader.WatchURL(ctx, treeURL, actCfg, func(v interface{}, err error) {
+			next, _ := v.(*cfg)
+			reloads <- reload{next, err}
+		})
+	}()
+
+	require.Eventually(t, func() bool {
+		source.mtx.Lock()
+		defer source.mtx.Unlock()
+		return source.indexes[treeURL] != 0
+	}, 5*time.Second, time.Millisecond)
+	consul.set("service/app/database/host", "db2.internal")
+
+	select {
+	case reloaded := <-reloads:
+		require.NoError(t, reloaded.err)
+		require.Equal(t, "app", actCfg.Name)
+		require.Equal(t, 8080, actCfg.Port)
+		require.Equal(t, "db.internal", actCfg.Database.Host)
+		require.Equal(t, 6543, actCfg.Database.Port)
+		require.Equal(t, []string{"a", "b"}, actCfg.Hosts)
+		require.Equal(t, map[string]string{"Team": "payments"}, actCfg.Labels)
+		require.Equal(t, "db2.internal", reloaded.cfg.Database.Host)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for reload")
+	}
+
+	cancel()
+	require.Equal(t, context.Canceled, <-done)
+
+	source.Token = "wrong"
+	_, err = source.Reader(treeURL)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "expected 200 response code but got 403")
+}
@@ -0,0 +1,249 @@
+package configurer
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Decrypter decrypts config payloads before they're unmarshalled, so that
+// encrypted configs can be committed to version control. Decrypters are
+// registered with RegisterDecrypter.
+type Decrypter interface {
+	// Decrypt returns the plaintext of payload, which unmarshaller will
+	// decode. Payloads that aren't encrypted, or only partially encrypted,
+	// should be returned with any unencrypted parts unchanged.
+	Decrypt(payload []byte, unmarshaller Unmarshaller) ([]byte, error)
+}
+
+const aesGCMKeySize = 32
+
+var aesGCMValueRegexp = regexp.MustCompile(`"ENC\[AES256_GCM,[^\]]*\]"|'ENC\[AES256_GCM,[^\]]*\]'|ENC\[AES256_GCM,[^\]]*\]`)
+
+// AESGCMDecrypter decrypts values encrypted with AES-256-GCM. Encrypted
+// values are written in a format borrowed from SOPS:
+//
+//	ENC[AES256_GCM,data:<base64>,iv:<base64>,tag:<base64>,type:<type>]
+//
+// If the entire payload is a single encrypted value, it's decrypted as a
+// whole. Otherwise each encrypted value in the document is replaced with its
+// plaintext, so that only the sensitive leaves of a config need to be
+// encrypted. Such values may be quoted or not, and their type (str, int,
+// float or bool) decides how the plaintext is written back. The type is
+// authenticated along with the ciphertext, so it can't be altered to splice
+// arbitrary text into the config.
+//
+// Encrypted values are only supported in JSON, JSON5, YAML and TOML configs,
+// and in the key maps built by sources like EnvSource, since strings are
+// written back in JSON syntax. Configs in other formats must be encrypted as
+// a whole.
+type AESGCMDecrypter struct {
+	aead cipher.AEAD
+}
+
+// NewAESGCMDecrypter creates an AESGCMDecrypter from a 32-byte key.
+func NewAESGCMDecrypter(key []byte) (*AESGCMDecrypter, error) {
+	if len(key) != aesGCMKeySize {
+		return nil, fmt.Errorf("expected a %d byte key but got %d bytes", aesGCMKeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating cipher")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating cipher")
+	}
+	return &AESGCMDecrypter{
+		aead: aead,
+	}, nil
+}
+
+// NewAESGCMDecrypterFromEnv creates an AESGCMDecrypter from a base64-encoded
+// key stored in the named environment variable.
+func NewAESGCMDecrypterFromEnv(name string) (*AESGCMDecrypter, error) {
+	encoded, ok := os.LookupEnv(name)
+	if !ok {
+		return nil, fmt.Errorf("environment variable %s is not set", name)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("environment variable %s is not valid base64", name))
+	}
+	return NewAESGCMDecrypter(key)
+}
+
+// NewAESGCMDecrypterFromFile creates an AESGCMDecrypter from a key file
+// containing either the raw key or its base64 encoding.
+func NewAESGCMDecrypterFromFile(path string) (*AESGCMDecrypter, error) {
+	key, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading key file")
+	}
+	if len(key) != aesGCMKeySize {
+		key, err = base64.StdEncoding.DecodeString(string(bytes.TrimSpace(key)))
+		if err != nil {
+			return nil, errors.Wrap(err, "key file is neither a raw key nor valid base64")
+		}
+	}
+	return NewAESGCMDecrypter(key)
+}
+
+func (a *AESGCMDecrypter) Decrypt(payload []byte, unmarshaller Unmarshaller) ([]byte, error) {
+	trimmed := bytes.TrimSpace(payload)
+	if loc := aesGCMValueRegexp.FindIndex(trimmed); loc != nil && loc[0] == 0 && loc[1] == len(trimmed) {
+		plaintext, _, err := a.decryptValue(string(trimmed))
+		return plaintext, err
+	}
+	if !aesGCMValueRegexp.Match(payload) {
+		return payload, nil
+	}
+
+	switch unmarshaller.(type) {
+	case *JSONUnmarshaller, *JSON5Unmarshaller, *YAMLUnmarshaller, *TOMLUnmarshaller, *KeyMapUnmarshaller:
+	default:
+		return nil, errors.New("encrypted values are only supported in JSON, YAML and TOML configs - encrypt the whole file instead")
+	}
+
+	var decryptErr error
+	res := aesGCMValueRegexp.ReplaceAllFunc(payload, func(match []byte) []byte {
+		if decryptErr != nil {
+			return match
+		}
+		plaintext, typ, err := a.decryptValue(string(match))
+		if err != nil {
+			decryptErr = err
+			return match
+		}
+		value, err := aesGCMPlaintextValue(plaintext, typ)
+		if err != nil {
+			decryptErr = err
+			return match
+		}
+		return value
+	})
+	if decryptErr != nil {
+		return nil, decryptErr
+	}
+	return res, nil
+}
+
+var aesGCMIntRegexp = regexp.MustCompile(`^[-+]?[0-9]+$`)
+
+// aesGCMPlaintextValue returns the text that replaces an encrypted value of
+// type typ. Strings are quoted in JSON syntax, which JSON, YAML and TOML all
+// accept, and anything else must be a bare scalar.
+func aesGCMPlaintextValue(plaintext []byte, typ string) ([]byte, error) {
+	switch typ {
+	case "str":
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(string(plaintext)); err != nil {
+			return nil, errors.Wrap(err, "error encoding decrypted value")
+		}
+		// TOML doesn't allow DEL in basic strings, but all three formats
+		// understand it escaped.
+		return bytes.ReplaceAll(bytes.TrimSuffix(buf.Bytes(), []byte("\n")), []byte("\x7f"), []byte(`\u007f`)), nil
+	case "int":
+		if !aesGCMIntRegexp.Match(plaintext) {
+			return nil, errors.New("decrypted value of type int is not an integer")
+		}
+	case "float":
+		f, err := strconv.ParseFloat(string(plaintext), 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) || strings.ContainsAny(string(plaintext), "xXpP_") {
+			return nil, errors.New("decrypted value of type float is not a number")
+		}
+	case "bool":
+		if string(plaintext) != "true" && string(plaintext) != "false" {
+			return nil, errors.New("decrypted value of type bool is not true or false")
+		}
+	default:
+		return nil, fmt.Errorf("unknown encrypted value type %s", typ)
+	}
+	return plaintext, nil
+}
+
+// Encrypt encrypts an entire config payload.
+func (a *AESGCMDecrypter) Encrypt(plaintext []byte) (string, error) {
+	return a.encryptValue(plaintext, "file")
+}
+
+// EncryptValue encrypts a single value for embedding in a config. value must
+// be a string, bool, integer or float.
+func (a *AESGCMDecrypter) EncryptValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return a.encryptValue([]byte(v), "str")
+	case bool:
+		return a.encryptValue([]byte(strconv.FormatBool(v)), "bool")
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return a.encryptValue([]byte(fmt.Sprint(v)), "int")
+	case float32:
+		return a.encryptValue([]byte(strconv.FormatFloat(float64(v), 'g', -1, 32)), "float")
+	case float64:
+		return a.encryptValue([]byte(strconv.FormatFloat(v, 'g', -1, 64)), "float")
+	default:
+		return "", fmt.Errorf("can't encrypt values of type %T", value)
+	}
+}
+
+func (a *AESGCMDecrypter) encryptValue(plaintext []byte, typ string) (string, error) {
+	iv := make([]byte, a.aead.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", errors.Wrap(err, "error generating IV")
+	}
+	sealed := a.aead.Seal(nil, iv, plaintext, []byte(typ))
+	tagIdx := len(sealed) - a.aead.Overhead()
+	return fmt.Sprintf(
+		"ENC[AES256_GCM,data:%s,iv:%s,tag:%s,type:%s]",
+		base64.StdEncoding.EncodeToString(sealed[:tagIdx]),
+		base64.StdEncoding.EncodeToString(iv),
+		base64.StdEncoding.EncodeToString(sealed[tagIdx:]),
+		typ,
+	), nil
+}
+
+func (a *AESGCMDecrypter) decryptValue(value string) ([]byte, string, error) {
+	value = strings.Trim(value, `"'`)
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "ENC[AES256_GCM,"), "]")
+
+	fields := make(map[string]string)
+	for _, field := range strings.Split(value, ",") {
+		kv := strings.SplitN(field, ":", 2)
+		if len(kv) != 2 {
+			return nil, "", errors.New("mal-formed encrypted value")
+		}
+		fields[kv[0]] = kv[1]
+	}
+
+	var parts [3][]byte
+	for i, name := range []string{"data", "iv", "tag"} {
+		part, err := base64.StdEncoding.DecodeString(fields[name])
+		if err != nil {
+			return nil, "", fmt.Errorf("mal-formed encrypted value: invalid %s", name)
+		}
+		parts[i] = part
+	}
+	data, iv, tag := parts[0], parts[1], parts[2]
+	if len(iv) != a.aead.NonceSize() || len(tag) != a.aead.Overhead() {
+		return nil, "", errors.New("mal-formed encrypted value")
+	}
+
+	plaintext, err := a.aead.Open(nil, iv, append(data, tag...), []byte(fields["type"]))
+	if err != nil {
+		return nil, "", errors.New("error decrypting value: wrong key or corrupted ciphertext")
+	}
+	return plaintext, fields["type"], nil
+}
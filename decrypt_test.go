@@ -0,0 +1,182 @@
+package configurer
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAESGCMDecrypter(t *testing.T) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	decrypter, err := NewAESGCMDecrypter(key)
+	require.NoError(t, err)
+
+	password, err := decrypter.EncryptValue(`hunter2 "quoted" \ slash`)
+	require.NoError(t, err)
+	port, err := decrypter.EncryptValue(5432)
+	require.NoError(t, err)
+	debug, err := decrypter.EncryptValue(true)
+	require.NoError(t, err)
+
+	type cfg struct {
+		Name     string `json:"name" yaml:"name" toml:"name" config:"required"`
+		Password string `json:"password" yaml:"password" toml:"password" config:"required"`
+		Port     int    `json:"port" yaml:"port" toml:"port"`
+		Debug    bool   `json:"debug" yaml:"debug" toml:"debug"`
+	}
+	expCfg := &cfg{
+		Name:     "app",
+		Password: `hunter2 "quoted" \ slash`,
+		Port:     5432,
+		Debug:    true,
+	}
+
+	mem := NewMemorySource()
+	loader := NewLoader()
+	loader.RegisterSource(mem)
+	loader.RegisterUnmarshaller(DefaultJSONUnmarshaller)
+	loader.RegisterUnmarshaller(DefaultYAMLUnmarshaller)
+	loader.RegisterUnmarshaller(DefaultTOMLUnmarshaller)
+	loader.RegisterDecrypter(decrypter)
+
+	mem.Set("app.json", []byte(fmt.Sprintf(`{"name": "app", "password": "%s", "port": "%s", "debug": "%s"}`, password, port, debug)))
+	mem.Set("app.yaml", []byte(fmt.Sprintf("name: app\npassword: '%s'\nport: %s\ndebug: \"%s\"\n", password, port, debug)))
+	mem.Set("app.toml", []byte(fmt.Sprintf("name = \"app\"\npassword = \"%s\"\nport = \"%s\"\ndebug = \"%s\"\n", password, port, debug)))
+	whole, err := decrypter.Encrypt([]byte(`{"name": "app", "password": "hunter2 \"quoted\" \\ slash", "port": 5432, "debug": true}`))
+	require.NoError(t, err)
+	mem.Set("whole.json", []byte(whole+"\n"))
+
+	for _, url := range []string{"mem://app.json", "mem://app.yaml", "mem://app.toml", "mem://whole.json"} {
+		actCfg := new(cfg)
+		require.NoError(t, loader.LoadURL(url, actCfg), url)
+		require.Equal(t, expCfg, actCfg, url)
+	}
+
+	otherKey := make([]byte, 32)
+	_, err = rand.Read(otherKey)
+	require.NoError(t, err)
+	otherDecrypter, err := NewAESGCMDecrypter(otherKey)
+	require.NoError(t, err)
+	_, err = otherDecrypter.Decrypt([]byte(whole), DefaultJSONUnmarshaller)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "wrong key or corrupted ciphertext")
+
+	plain := []byte(`{"name": "app"}`)
+	res, err := decrypter.Decrypt(plain, DefaultJSONUnmarshaller)
+	require.NoError(t, err)
+	require.Equal(t, plain, res)
+
+	_, err = NewAESGCMDecrypter(key[:16])
+	require.Error(t, err)
+}
+
+func TestAESGCMDecrypter_Keys(t *testing.T) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	expected, err := NewAESGCMDecrypter(key)
+	require.NoError(t, err)
+	ciphertext, err := expected.EncryptValue("secret")
+	require.NoError(t, err)
+
+	require.NoError(t, os.Setenv("CONFIGURER_TEST_KEY", base64.StdEncoding.EncodeToString(key)))
+	defer os.Unsetenv("CONFIGURER_TEST_KEY")
+	fromEnv, err := NewAESGCMDecrypterFromEnv("CONFIGURER_TEST_KEY")
+	require.NoError(t, err)
+	res, err := fromEnv.Decrypt([]byte(ciphertext), DefaultJSONUnmarshaller)
+	require.NoError(t, err)
+	require.Equal(t, "secret", string(res))
+
+	_, err = NewAESGCMDecrypterFromEnv("CONFIGURER_TEST_MISSING_KEY")
+	require.Error(t, err)
+
+	for _, content := range [][]byte{key, []byte(base64.StdEncoding.EncodeToString(key) + "\n")} {
+		keyFile, err := ioutil.TempFile("", "configurer_")
+		require.NoError(t, err)
+		defer os.Remove(keyFile.Name())
+		_, err = keyFile.Write(content)
+		require.NoError(t, err)
+		require.NoError(t, keyFile.Close())
+
+		fromFile, err := NewAESGCMDecrypterFromFile(keyFile.Name())
+		require.NoError(t, err)
+		res, err := fromFile.Decrypt([]byte(ciphertext), DefaultJSONUnmarshaller)
+		require.NoError(t, err)
+		require.Equal(t, "secret", string(res))
+	}
+}
+
+func TestAESGCMDecrypter_Formats(t *testing.T) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	decrypter, err := NewAESGCMDecrypter(key)
+	require.NoError(t, err)
+
+	password, err := decrypter.EncryptValue("<p@ss> \x7f")
+	require.NoError(t, err)
+
+	type cfg struct {
+		Name     string `config:"required"`
+		Password string `config:"required"`
+	}
+
+	mem := NewMemorySource()
+	loader := NewLoader()
+	loader.RegisterSource(mem)
+	loader.RegisterSource(new(EnvSource))
+	loader.RegisterUnmarshaller(DefaultTOMLUnmarshaller)
+	loader.RegisterUnmarshaller(DefaultPropertiesUnmarshaller)
+	loader.RegisterUnmarshaller(DefaultDotenvUnmarshaller)
+	loader.RegisterUnmarshaller(DefaultXMLUnmarshaller)
+	loader.RegisterDecrypter(decrypter)
+
+	mem.Set("app.toml", []byte(fmt.Sprintf("name = \"app\"\npassword = \"%s\"\n", password)))
+	actCfg := new(cfg)
+	require.NoError(t, loader.LoadURL("mem://app.toml", actCfg))
+	require.Equal(t, "<p@ss> \x7f", actCfg.Password)
+
+	require.NoError(t, os.Setenv("DECRYPTTEST_NAME", "app"))
+	require.NoError(t, os.Setenv("DECRYPTTEST_PASSWORD", password))
+	defer os.Unsetenv("DECRYPTTEST_NAME")
+	defer os.Unsetenv("DECRYPTTEST_PASSWORD")
+	actCfg = new(cfg)
+	require.NoError(t, loader.LoadURL("env://DECRYPTTEST", actCfg))
+	require.Equal(t, "<p@ss> \x7f", actCfg.Password)
+
+	// Formats with their own string syntax must be encrypted as a whole.
+	mem.Set("app.properties", []byte("name=app\npassword="+password+"\n"))
+	mem.Set("app.env", []byte("NAME=app\nPASSWORD="+password+"\n"))
+	mem.Set("app.xml", []byte("<config><name>app</name><password>"+password+"</password></config>"))
+	for _, url := range []string{"mem://app.properties", "mem://app.env", "mem://app.xml"} {
+		err := loader.LoadURL(url, new(cfg))
+		require.Error(t, err, url)
+		require.Contains(t, err.Error(), "encrypted values are only supported in JSON, YAML and TOML configs", url)
+	}
+	whole, err := decrypter.Encrypt([]byte("name=app\npassword=<p@ss>\n"))
+	require.NoError(t, err)
+	mem.Set("whole.properties", []byte(whole))
+	actCfg = new(cfg)
+	require.NoError(t, loader.LoadURL("mem://whole.properties", actCfg))
+	require.Equal(t, "<p@ss>", actCfg.Password)
+
+	// The type is authenticated, so it can't be changed to splice raw text
+	// into the config.
+	spliced := strings.Replace(password, "type:str", "type:int", 1)
+	_, err = decrypter.Decrypt([]byte(`{"password": `+spliced+`}`), DefaultJSONUnmarshaller)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "wrong key or corrupted ciphertext")
+
+	notInt, err := decrypter.encryptValue([]byte("1\nadmin: true"), "int")
+	require.NoError(t, err)
+	_, err = decrypter.Decrypt([]byte("port: "+notInt+"\n"), DefaultYAMLUnmarshaller)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "decrypted value of type int is not an integer")
+}
@@ -0,0 +1,200 @@
+package configurer
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const DOTENV = "env"
+
+// DotenvUnmarshaller decodes .env files of KEY=value lines, as used for local
+// development. Lines may start with export, and # starts a comment unless
+// it's inside a quoted value. Single-quoted values are taken literally, while
+// double-quoted values support \n, \r, \t, \", \\ and \$ escapes. Both may
+// span multiple lines.
+//
+// As with env:// URLs, names are split into nested keys by double
+// underscores, so DATABASE__HOST populates the Host field of the Database
+// struct. A field tagged with config:"env=NAME" is matched by NAME rather
+// than its field name. Such names are global, so a nested field tagged with
+// env=DB_HOST is populated by DB_HOST rather than DATABASE__DB_HOST.
+type DotenvUnmarshaller struct {
+}
+
+var DefaultDotenvUnmarshaller = new(DotenvUnmarshaller)
+
+func (d *DotenvUnmarshaller) Extensions() []string {
+	return []string{DOTENV}
+}
+
+func (d *DotenvUnmarshaller) ExtractFieldName(field reflect.StructField) string {
+	fieldCfg, err := parseStructTag(field.Tag.Get(TagName))
+	if err != nil || fieldCfg.Env == "" {
+		return field.Name
+	}
+	return fieldCfg.Env
+}
+
+func (d *DotenvUnmarshaller) Unmarshal(data []byte, v interface{}) error {
+	keyMap, err := d.parse(string(data))
+	if err != nil {
+		return err
+	}
+	if mapPtr, ok := v.(*map[string]interface{}); ok {
+		*mapPtr = keyMap
+		return nil
+	}
+	return decodeKeyMap(d.resolveKeyMap(keyMap, reflect.TypeOf(v)), v, d.ExtractFieldName)
+}
+
+// resolveKeyMap copies the values of variables named by the env tags of
+// nested fields to where those fields are looked up, since variable names
+// are global however deeply the field is nested.
+func (d *DotenvUnmarshaller) resolveKeyMap(keyMap map[string]interface{}, t reflect.Type) map[string]interface{} {
+	d.resolveEnvFields(keyMap, t, nil, nil)
+	return keyMap
+}
+
+func (d *DotenvUnmarshaller) resolveEnvFields(root map[string]interface{}, t reflect.Type, path []string, seen []reflect.Type) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for _, seenType := range seen {
+		if seenType == t {
+			return
+		}
+	}
+	seen = append(seen, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		fieldPath := append(append([]string(nil), path...), d.ExtractFieldName(field))
+		if fieldCfg, err := parseStructTag(field.Tag.Get(TagName)); err == nil && fieldCfg.Env != "" && len(path) > 0 {
+			if _, val, ok := lookupKeyMap(root, fieldCfg.Env); ok {
+				setKeyMapPath(root, fieldPath, val)
+			}
+		}
+		d.resolveEnvFields(root, field.Type, fieldPath, seen)
+	}
+}
+
+func (d *DotenvUnmarshaller) parse(data string) (map[string]interface{}, error) {
+	keyMap := make(map[string]interface{})
+	lines := strings.Split(strings.TrimPrefix(strings.ReplaceAll(data, "\r\n", "\n"), "\ufeff"), "\n")
+	for idx := 0; idx < len(lines); idx++ {
+		lineNum := idx + 1
+		line := strings.TrimSpace(lines[idx])
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if strings.HasPrefix(line, "export ") || strings.HasPrefix(line, "export\t") {
+			line = strings.TrimSpace(line[len("export"):])
+		}
+
+		eqIdx := strings.Index(line, "=")
+		if eqIdx == -1 {
+			return nil, fmt.Errorf("line %d: expected KEY=value", lineNum)
+		}
+		name := strings.TrimSpace(line[:eqIdx])
+		if !d.validName(name) {
+			return nil, fmt.Errorf("line %d: invalid variable name %q", lineNum, name)
+		}
+		raw := strings.TrimSpace(line[eqIdx+1:])
+
+		var value string
+		if raw != "" && (raw[0] == '"' || raw[0] == '\'') {
+			// Quoted values continue onto the following lines until the
+			// closing quote.
+			quoted := raw
+			for d.closingQuote(quoted) == -1 {
+				idx++
+				if idx == len(lines) {
+					return nil, fmt.Errorf("line %d: unterminated quoted value for %s", lineNum, name)
+				}
+				quoted += "\n" + lines[idx]
+			}
+			end := d.closingQuote(quoted)
+			if rest := strings.TrimSpace(quoted[end+1:]); rest != "" && rest[0] != '#' {
+				return nil, fmt.Errorf("line %d: unexpected %s after quoted value for %s", lineNum, rest, name)
+			}
+			value = quoted[1:end]
+			if quoted[0] == '"' {
+				value = d.unescape(value)
+			}
+		} else {
+			value = raw
+			for i := 1; i < len(raw); i++ {
+				if raw[i] == '#' && (raw[i-1] == ' ' || raw[i-1] == '\t') {
+					value = strings.TrimSpace(raw[:i])
+					break
+				}
+			}
+		}
+
+		setKeyMapPath(keyMap, strings.Split(strings.ToLower(name), "__"), value)
+	}
+	return keyMap, nil
+}
+
+func (d *DotenvUnmarshaller) validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c == '_', 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z':
+		case i > 0 && ('0' <= c && c <= '9' || c == '.' || c == '-'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// closingQuote returns the index of the quote that ends the quoted value at
+// the start of raw, or -1 if it hasn't been closed. Backslashes only escape
+// inside double quotes.
+func (d *DotenvUnmarshaller) closingQuote(raw string) int {
+	quote := raw[0]
+	for i := 1; i < len(raw); i++ {
+		switch {
+		case raw[i] == '\\' && quote == '"':
+			i++
+		case raw[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+func (d *DotenvUnmarshaller) unescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case '"', '\\', '$':
+			b.WriteByte(s[i])
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
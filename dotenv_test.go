@@ -0,0 +1,95 @@
+package configurer
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestDotenvUnmarshaller(t *testing.T) {
+	type cfg struct {
+		DatabaseURL string `config:"env=DATABASE_URL,required"`
+		Greeting    string
+		Literal     string
+		Certificate string
+		Port        int `config:"default=8080"`
+		Debug       bool
+		Cache       struct {
+			Host string `config:"required"`
+			TTL  int
+		}
+	}
+
+	actCfg := new(cfg)
+	require.NoError(t, DefaultDotenvUnmarshaller.Unmarshal([]byte(`# local development
+export DATABASE_URL=postgres://localhost:5432/app # inline comment
+GREETING="hello \"world\"\t# not a comment\n"
+LITERAL='C:\configs\$HOME # kept'
+CERTIFICATE="-----BEGIN CERTIFICATE-----
+MIIB
+-----END CERTIFICATE-----"
+DEBUG=true
+
+CACHE__HOST = redis.internal
+CACHE__TTL=60
+`), actCfg))
+	require.Equal(t, "postgres://localhost:5432/app", actCfg.DatabaseURL)
+	require.Equal(t, "hello \"world\"\t# not a comment\n", actCfg.Greeting)
+	require.Equal(t, `C:\configs\$HOME # kept`, actCfg.Literal)
+	require.Equal(t, "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----", actCfg.Certificate)
+	require.True(t, actCfg.Debug)
+	require.Equal(t, "redis.internal", actCfg.Cache.Host)
+	require.Equal(t, 60, actCfg.Cache.TTL)
+
+	loader := NewLoader()
+	loader.RegisterSource(DefaultMemorySource)
+	loader.RegisterUnmarshaller(DefaultDotenvUnmarshaller)
+	DefaultMemorySource.Set("app.env", []byte("DATABASE_URL=postgres://db\nCACHE__HOST=redis\n"))
+	defer DefaultMemorySource.Delete("app.env")
+	actCfg = new(cfg)
+	require.NoError(t, loader.LoadURL("mem://app.env", actCfg))
+	require.Equal(t, "postgres://db", actCfg.DatabaseURL)
+	require.Equal(t, 8080, actCfg.Port)
+
+	DefaultMemorySource.Set("app.env", []byte("CACHE__HOST=redis\n"))
+	err := loader.LoadURL("mem://app.env", new(cfg))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "required field DatabaseURL not found")
+
+	for input, msg := range map[string]string{
+		"DEBUG=true\nPORT\n":             "line 2: expected KEY=value",
+		"1PORT=80\n":                     "line 1: invalid variable name \"1PORT\"",
+		"A=1\nCERT=\"-----BEGIN\nMIIB\n": "line 2: unterminated quoted value for CERT",
+		"GREETING='hello' world\n":       "line 1: unexpected world after quoted value for GREETING",
+	} {
+		err := DefaultDotenvUnmarshaller.Unmarshal([]byte(input), new(map[string]interface{}))
+		require.Error(t, err, input)
+		require.Contains(t, err.Error(), msg)
+	}
+}
+
+func TestDotenvUnmarshaller_NestedEnvFields(t *testing.T) {
+	type cfg struct {
+		Database struct {
+			Host string `config:"env=DB_HOST,required"`
+			Port int    `config:"env=DB_PORT,default=5432"`
+			Name string
+		}
+	}
+
+	loader := NewLoader()
+	loader.RegisterSource(DefaultMemorySource)
+	loader.RegisterUnmarshaller(DefaultDotenvUnmarshaller)
+	DefaultMemorySource.Set("nested.env", []byte("DB_HOST=x\nDATABASE__NAME=app\n"))
+	defer DefaultMemorySource.Delete("nested.env")
+
+	actCfg := new(cfg)
+	require.NoError(t, loader.LoadURL("mem://nested.env", actCfg))
+	require.Equal(t, "x", actCfg.Database.Host)
+	require.Equal(t, 5432, actCfg.Database.Port)
+	require.Equal(t, "app", actCfg.Database.Name)
+
+	DefaultMemorySource.Set("nested.env", []byte("DATABASE__NAME=app\n"))
+	err := loader.LoadURL("mem://nested.env", new(cfg))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "required field Host not found")
+}
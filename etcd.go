@@ -0,0 +1,246 @@
+package configurer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// EtcdSource reads configs from etcd through its v3 JSON gateway. Keys are
+// given by the URL's path, including its leading slash. A URL naming a
+// single key, e.g. etcd://127.0.0.1:2379/config/app.yaml, reads that key as
+// a config file whose format is taken from its extension. A URL ending in a
+// slash, e.g. etcd://127.0.0.1:2379/config/app/, reads every key under the
+// prefix as a tree: key paths below the prefix become nested keys, so
+// /config/app/database/host populates the Host field of the Database struct.
+// Trees are decoded by DefaultKeyMapUnmarshaller.
+//
+// Watch uses etcd's watch API to wait for changes.
+type EtcdSource struct {
+	// Scheme is used to reach the gateway. Defaults to http.
+	Scheme string
+	// Client is used to make requests. Defaults to http.DefaultClient.
+	Client *http.Client
+
+	mtx       sync.Mutex
+	revisions map[string]int64
+}
+
+type etcdRangeRequest struct {
+	Key      []byte `json:"key"`
+	RangeEnd []byte `json:"range_end,omitempty"`
+}
+
+type etcdHeader struct {
+	Revision int64 `json:"revision,string"`
+}
+
+type etcdKV struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+type etcdRangeResponse struct {
+	Header etcdHeader `json:"header"`
+	KVs    []etcdKV   `json:"kvs"`
+}
+
+type etcdWatchCreateRequest struct {
+	Key           []byte `json:"key"`
+	RangeEnd      []byte `json:"range_end,omitempty"`
+	StartRevision int64  `json:"start_revision,string"`
+}
+
+type etcdWatchRequest struct {
+	CreateRequest etcdWatchCreateRequest `json:"create_request"`
+}
+
+type etcdWatchResponse struct {
+	Result struct {
+		Canceled     bool        `json:"canceled"`
+		CancelReason string      `json:"cancel_reason"`
+		Events       []etcdEvent `json:"events"`
+	} `json:"result"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type etcdEvent struct {
+	KV etcdKV `json:"kv"`
+}
+
+func (e *EtcdSource) Protocols() []string {
+	return []string{"etcd"}
+}
+
+func (e *EtcdSource) Format(url string) Unmarshaller {
+	if strings.HasSuffix(url, "/") {
+		return DefaultKeyMapUnmarshaller
+	}
+	return nil
+}
+
+func (e *EtcdSource) Synthetic(url string) bool {
+	return strings.HasSuffix(url, "/")
+}
+
+func (e *EtcdSource) Reader(url string) (io.ReadCloser, error) {
+	host, key := e.location(url)
+	tree := strings.HasSuffix(key, "/")
+	rangeReq := etcdRangeRequest{
+		Key: []byte(key),
+	}
+	if tree {
+		rangeReq.RangeEnd = etcdPrefixEnd(key)
+	}
+
+	var rangeRes etcdRangeResponse
+	res, err := e.post(context.Background(), host, "/v3/kv/range", rangeReq)
+	if err != nil {
+		return nil, err
+	}
+	err = json.NewDecoder(res.Body).Decode(&rangeRes)
+	res.Body.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding etcd response")
+	}
+
+	e.mtx.Lock()
+	if e.revisions == nil {
+		e.revisions = make(map[string]int64)
+	}
+	e.revisions[url] = rangeRes.Header.Revision
+	e.mtx.Unlock()
+
+	if !tree {
+		if len(rangeRes.KVs) == 0 {
+			return nil, fmt.Errorf("key %s not found in etcd", key)
+		}
+		return ioutil.NopCloser(bytes.NewReader(rangeRes.KVs[0].Value)), nil
+	}
+
+	keyMap := make(map[string]interface{})
+	for _, kv := range rangeRes.KVs {
+		rel := strings.Trim(strings.TrimPrefix(string(kv.Key), key), "/")
+		if rel == "" {
+			continue
+		}
+		setKeyMapPath(keyMap, strings.Split(rel, "/"), string(kv.Value))
+	}
+	return encodeKeyMap(keyMap)
+}
+
+func (e *EtcdSource) Watch(ctx context.Context, url string) error {
+	e.mtx.Lock()
+	revision, ok := e.revisions[url]
+	e.mtx.Unlock()
+	if !ok {
+		rd, err := e.Reader(url)
+		if err != nil {
+			return err
+		}
+		rd.Close()
+		e.mtx.Lock()
+		revision = e.revisions[url]
+		e.mtx.Unlock()
+	}
+
+	host, key := e.location(url)
+	createReq := etcdWatchCreateRequest{
+		Key:           []byte(key),
+		StartRevision: revision + 1,
+	}
+	if strings.HasSuffix(key, "/") {
+		createReq.RangeEnd = etcdPrefixEnd(key)
+	}
+	res, err := e.post(ctx, host, "/v3/watch", etcdWatchRequest{
+		CreateRequest: createReq,
+	})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	dec := json.NewDecoder(res.Body)
+	for {
+		var watchRes etcdWatchResponse
+		if err := dec.Decode(&watchRes); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return errors.Wrap(err, "error reading etcd watch stream")
+		}
+		if watchRes.Error != nil {
+			return fmt.Errorf("etcd watch failed: %s", watchRes.Error.Message)
+		}
+		if watchRes.Result.Canceled {
+			return fmt.Errorf("etcd watch was canceled: %s", watchRes.Result.CancelReason)
+		}
+		if len(watchRes.Result.Events) > 0 {
+			return nil
+		}
+	}
+}
+
+func (e *EtcdSource) post(ctx context.Context, host string, path string, body interface{}) (*http.Response, error) {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "error encoding etcd request")
+	}
+	scheme := e.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s://%s%s", scheme, host, path), bytes.NewReader(buf))
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error querying etcd")
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, &StatusError{
+			StatusCode: res.StatusCode,
+		}
+	}
+	return res, nil
+}
+
+func (e *EtcdSource) location(url string) (string, string) {
+	location := strings.TrimPrefix(url, "etcd://")
+	slashIdx := strings.Index(location, "/")
+	if slashIdx == -1 {
+		return location, "/"
+	}
+	return location[:slashIdx], location[slashIdx:]
+}
+
+// etcdPrefixEnd returns the range end that selects every key starting with
+// prefix, following etcd's clientv3.GetPrefixRangeEnd.
+func etcdPrefixEnd(prefix string) []byte {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return []byte{0}
+}
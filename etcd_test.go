@@ -0,0 +1,200 @@
+package configurer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeEtcd struct {
+	mtx      sync.Mutex
+	kv       map[string][]byte
+	modified map[string]int64
+	revision int64
+	changed  chan struct{}
+}
+
+func newFakeEtcd() *fakeEtcd {
+	return &fakeEtcd{
+		kv:       make(map[string][]byte),
+		modified: make(map[string]int64),
+		revision: 1,
+		changed:  make(chan struct{}),
+	}
+}
+
+func (f *fakeEtcd) put(key string, value string) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.revision++
+	f.kv[key] = []byte(value)
+	f.modified[key] = f.revision
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *fakeEtcd) inRange(key string, start []byte, end []byte) bool {
+	if len(end) == 0 {
+		return key == string(start)
+	}
+	return key >= string(start) && (bytes.Equal(end, []byte{0}) || key < string(end))
+}
+
+func (f *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/v3/kv/range":
+		var req etcdRangeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.mtx.Lock()
+		defer f.mtx.Unlock()
+		var keys []string
+		for k := range f.kv {
+			if f.inRange(k, req.Key, req.RangeEnd) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		res := etcdRangeResponse{
+			Header: etcdHeader{Revision: f.revision},
+		}
+		for _, k := range keys {
+			res.KVs = append(res.KVs, etcdKV{Key: []byte(k), Value: f.kv[k]})
+		}
+		json.NewEncoder(w).Encode(res)
+	case "/v3/watch":
+		var req etcdWatchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		create := req.CreateRequest
+		fmt.Fprintln(w, `{"result":{"header":{"revision":"1"},"created":true}}`)
+		w.(http.Flusher).Flush()
+		for {
+			f.mtx.Lock()
+			var events []string
+			for k, rev := range f.modified {
+				if rev >= create.StartRevision && f.inRange(k, create.Key, create.RangeEnd) {
+					events = append(events, k)
+				}
+			}
+			changed := f.changed
+			f.mtx.Unlock()
+			if len(events) > 0 {
+				res := etcdWatchResponse{}
+				for _, k := range events {
+					res.Result.Events = append(res.Result.Events, etcdEvent{KV: etcdKV{Key: []byte(k)}})
+				}
+				json.NewEncoder(w).Encode(res)
+				w.(http.Flusher).Flush()
+			}
+			select {
+			case <-changed:
+			case <-r.Context().Done():
+				return
+			}
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestEtcdSource(t *testing.T) {
+	etcd := newFakeEtcd()
+	etcd.put("/service/app/name", "app")
+	etcd.put("/service/app/database/host", "db.internal")
+	etcd.put("/service/app/database/port", "6543")
+	etcd.put("/service/app/hosts/0", "a")
+	etcd.put("/service/app/hosts/1", "b")
+	etcd.put("/service/app/labels/Team", "payments")
+	etcd.put("/service/apps/name", "other")
+	etcd.put("/service/app.yaml", "name: blob\ndatabase:\n  host: blob.internal\n")
+	ts := httptest.NewServer(etcd)
+	defer ts.Close()
+	host := strings.TrimPrefix(ts.URL, "http://")
+
+	source := new(EtcdSource)
+	loader := NewLoader()
+	loader.RegisterSource(source)
+	loader.RegisterUnmarshaller(DefaultYAMLUnmarshaller)
+
+	type cfg struct {
+		Name     string `config:"required"`
+		Port     int    `config:"default=8080"`
+		Database struct {
+			Host string `config:"required"`
+			Port int
+		}
+		Hosts  []string
+		Labels map[string]string
+	}
+
+	actCfg := new(cfg)
+	require.NoError(t, loader.LoadURL(fmt.Sprintf("etcd://%s/service/app.yaml", host), actCfg))
+	require.Equal(t, "blob", actCfg.Name)
+	require.Equal(t, 8080, actCfg.Port)
+
+	err := loader.LoadURL(fmt.Sprintf("etcd://%s/service/missing.yaml", host), new(cfg))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "key /service/missing.yaml not found in etcd")
+
+	treeURL := fmt.Sprintf("etcd://%s/service/app/", host)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	actCfg = new(cfg)
+	type reload struct {
+		cfg *cfg
+		err error
+	}
+	reloads := make(chan reload)
+	done := make(chan error)
+	go func() {
+		done <- loader.WatchURL(ctx, treeURL, actCfg, func(v interface{}, err error) {
+			next, _ := v.(*cfg)
+			reloads <- reload{next, err}
+		})
+	}()
+
+	require.Eventually(t, func() bool {
+		source.mtx.Lock()
+		defer source.mtx.Unlock()
+		return source.revisions[treeURL] != 0
+	}, 5*time.Second, time.Millisecond)
+	etcd.put("/service/apps/name", "ignored")
+	etcd.put("/service/app/database/host", "db2.internal")
+
+	select {
+	case reloaded := <-reloads:
+		require.NoError(t, reloaded.err)
+		require.Equal(t, "app", actCfg.Name)
+		require.Equal(t, 8080, actCfg.Port)
+		require.Equal(t, "db.internal", actCfg.Database.Host)
+		require.Equal(t, 6543, actCfg.Database.Port)
+		require.Equal(t, []string{"a", "b"}, actCfg.Hosts)
+		require.Equal(t, map[string]string{"Team": "payments"}, actCfg.Labels)
+		require.Equal(t, "db2.internal", reloaded.cfg.Database.Host)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for reload")
+	}
+
+	cancel()
+	require.Equal(t, context.Canceled, <-done)
+}
+
+func TestEtcdPrefixEnd(t *testing.T) {
+	require.Equal(t, []byte("/app0"), etcdPrefixEnd("/app/"))
+	require.Equal(t, []byte("b"), etcdPrefixEnd("a\xff"))
+	require.Equal(t, []byte{0}, etcdPrefixEnd("\xff\xff"))
+}
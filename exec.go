@@ -0,0 +1,138 @@
+package configurer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const maxExecStderr = 4096
+
+// execKillGrace is how long a timed out command is waited for after it's
+// killed.
+const execKillGrace = time.Second
+
+// ExecCommand is a command that ExecSource runs to obtain a config.
+type ExecCommand struct {
+	Path string
+	Args []string
+	// Env holds KEY=value pairs added to the current environment.
+	Env []string
+	// Dir is the working directory. Defaults to the current one.
+	Dir string
+}
+
+// ExecSource obtains configs from the standard output of a command, e.g. a
+// script that renders a template or queries a CMDB. Only commands registered
+// in Commands can be run: the URL names one, so exec://cmdb.json runs
+// Commands["cmdb.json"] and decodes its output as JSON. ExecSource isn't
+// registered by default.
+type ExecSource struct {
+	Commands map[string]*ExecCommand
+	// Timeout bounds how long a command may run. When it's exceeded, the
+	// command is killed along with any processes it started, except on
+	// Windows where only the command itself is. Processes left running keep
+	// going in the background, but Reader returns regardless. Defaults to
+	// one minute.
+	Timeout time.Duration
+}
+
+// ExecError is returned by ExecSource when a command fails.
+type ExecError struct {
+	Name     string
+	ExitCode int
+	Stderr   string
+	Err      error
+}
+
+func (e *ExecError) Error() string {
+	msg := fmt.Sprintf("command %s failed: %v", e.Name, e.Err)
+	if e.ExitCode > 0 {
+		msg = fmt.Sprintf("command %s exited with code %d", e.Name, e.ExitCode)
+	}
+	if e.Stderr != "" {
+		msg += ": " + e.Stderr
+	}
+	return msg
+}
+
+func (e *ExecError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ExecSource) Protocols() []string {
+	return []string{"exec"}
+}
+
+func (e *ExecSource) Reader(url string) (io.ReadCloser, error) {
+	name := strings.TrimPrefix(url, "exec://")
+	command := e.Commands[name]
+	if command == nil {
+		return nil, fmt.Errorf("no command registered under %s", name)
+	}
+
+	timeout := e.Timeout
+	if timeout == 0 {
+		timeout = time.Minute
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(command.Path, command.Args...)
+	cmd.Env = append(os.Environ(), command.Env...)
+	cmd.Dir = command.Dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	setProcessGroup(cmd)
+
+	var timedOut, abandoned bool
+	err := cmd.Start()
+	if err == nil {
+		// Killing just the command on timeout isn't enough: Wait also waits
+		// for its output to be copied, and any children it spawned may hold
+		// on to the pipe.
+		done := make(chan error, 1)
+		go func() {
+			done <- cmd.Wait()
+		}()
+		timer := time.NewTimer(timeout)
+		select {
+		case err = <-done:
+			timer.Stop()
+		case <-timer.C:
+			timedOut = true
+			killProcessGroup(cmd)
+			// Processes that survive the kill can keep Wait blocked for as
+			// long as they hold on to the pipe, so they're not waited for.
+			// Their output is still being copied, so stderr can't be read.
+			select {
+			case err = <-done:
+			case <-time.After(execKillGrace):
+				abandoned = true
+			}
+		}
+	}
+	if err != nil || timedOut {
+		execErr := &ExecError{
+			Name:     name,
+			ExitCode: -1,
+			Err:      err,
+		}
+		if !abandoned {
+			execErr.Stderr = strings.TrimSpace(stderr.String())
+		}
+		if len(execErr.Stderr) > maxExecStderr {
+			execErr.Stderr = execErr.Stderr[:maxExecStderr] + "..."
+		}
+		if timedOut {
+			execErr.Err = fmt.Errorf("timed out after %s", timeout)
+		} else if exitErr, ok := err.(*exec.ExitError); ok {
+			execErr.ExitCode = exitErr.ExitCode()
+		}
+		return nil, execErr
+	}
+	return ioutil.NopCloser(&stdout), nil
+}
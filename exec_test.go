@@ -0,0 +1,73 @@
+package configurer
+
+import (
+	"github.com/stretchr/testify/require"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestExecSource(t *testing.T) {
+	source := &ExecSource{
+		Commands: map[string]*ExecCommand{
+			"render.yaml": {
+				Path: "/bin/sh",
+				Args: []string{"-c", `printf 'name: %s\nport: 8080\n' "$APP_NAME"`},
+				Env:  []string{"APP_NAME=rendered"},
+			},
+			"fail.yaml": {
+				Path: "/bin/sh",
+				Args: []string{"-c", "echo 'cmdb unreachable' >&2; exit 3"},
+			},
+			"slow.yaml": {
+				Path: "/bin/sh",
+				Args: []string{"-c", "sleep 3; echo 'name: slow'"},
+			},
+		},
+		Timeout: 200 * time.Millisecond,
+	}
+	loader := NewLoader()
+	loader.RegisterSource(source)
+	loader.RegisterUnmarshaller(DefaultYAMLUnmarshaller)
+
+	type cfg struct {
+		Name string `config:"required"`
+		Port int
+	}
+	actCfg := new(cfg)
+	require.NoError(t, loader.LoadURL("exec://render.yaml", actCfg))
+	require.Equal(t, "rendered", actCfg.Name)
+	require.Equal(t, 8080, actCfg.Port)
+
+	_, err := source.Reader("exec://fail.yaml")
+	require.Error(t, err)
+	execErr, ok := err.(*ExecError)
+	require.True(t, ok)
+	require.Equal(t, 3, execErr.ExitCode)
+	require.Equal(t, "cmdb unreachable", execErr.Stderr)
+	require.Equal(t, "command fail.yaml exited with code 3: cmdb unreachable", err.Error())
+
+	start := time.Now()
+	_, err = source.Reader("exec://slow.yaml")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "timed out after 200ms")
+	require.Less(t, int64(time.Since(start)), int64(2*time.Second))
+
+	// A process that escapes the kill and holds on to the pipe isn't waited
+	// for.
+	if _, err := exec.LookPath("setsid"); err == nil {
+		source.Commands["escaped.yaml"] = &ExecCommand{
+			Path: "/bin/sh",
+			Args: []string{"-c", "setsid sleep 3 & sleep 3"},
+		}
+		start = time.Now()
+		_, err = source.Reader("exec://escaped.yaml")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "timed out after 200ms")
+		require.Less(t, int64(time.Since(start)), int64(2500*time.Millisecond))
+	}
+
+	_, err = source.Reader("exec://missing.yaml")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no command registered under missing.yaml")
+}
@@ -0,0 +1,14 @@
+package configurer
+
+import (
+	"os/exec"
+)
+
+// setProcessGroup does nothing on Windows, where only the command itself is
+// killed on timeout.
+func setProcessGroup(cmd *exec.Cmd) {
+}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,87 @@
+package configurer
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os/exec"
+	"strings"
+)
+
+// GitSource reads a config file at a specific ref of a local git
+// repository, so that config versions are pinned and auditable. URLs take
+// the form git:///srv/configrepo?ref=v1.4.2#envs/prod.yaml, where ref is a
+// branch, tag or commit and defaults to HEAD. The git binary must be
+// installed.
+type GitSource struct {
+	// GitPath is the git binary to run. Defaults to git on the PATH.
+	GitPath string
+	// OnResolve is called with the commit each URL's ref resolved to, e.g.
+	// to log exactly which config version was loaded.
+	OnResolve func(url string, commit string)
+}
+
+func (g *GitSource) Protocols() []string {
+	return []string{"git"}
+}
+
+func (g *GitSource) Reader(rawURL string) (io.ReadCloser, error) {
+	location := strings.TrimPrefix(rawURL, "git://")
+	hashIdx := strings.Index(location, "#")
+	if hashIdx == -1 || hashIdx == len(location)-1 {
+		return nil, errors.New("git url should contain the path to read after #")
+	}
+	filePath := strings.TrimPrefix(location[hashIdx+1:], "/")
+	location = location[:hashIdx]
+
+	ref := "HEAD"
+	if queryIdx := strings.Index(location, "?"); queryIdx != -1 {
+		query, err := url.ParseQuery(location[queryIdx+1:])
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid git url query")
+		}
+		if queryRef := query.Get("ref"); queryRef != "" {
+			ref = queryRef
+		}
+		location = location[:queryIdx]
+	}
+	if strings.HasPrefix(ref, "-") {
+		return nil, fmt.Errorf("invalid git ref %s", ref)
+	}
+
+	commit, err := g.git(location, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("error resolving ref %s", ref))
+	}
+	commitID := strings.TrimSpace(string(commit))
+	if g.OnResolve != nil {
+		g.OnResolve(rawURL, commitID)
+	}
+
+	blob, err := g.git(location, "cat-file", "blob", commitID+":"+filePath)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("error reading %s at %s", filePath, ref))
+	}
+	return ioutil.NopCloser(bytes.NewReader(blob)), nil
+}
+
+func (g *GitSource) git(repo string, args ...string) ([]byte, error) {
+	gitPath := g.GitPath
+	if gitPath == "" {
+		gitPath = "git"
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(gitPath, append([]string{"-C", repo}, args...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%v: %s", err, msg)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,89 @@
+package configurer
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGitSource(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "configurer_")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com", "-c", "commit.gpgsign=false", "-c", "tag.gpgsign=false"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+	commitConfig := func(port int, msg string) {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "envs"), 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "envs", "prod.yaml"), []byte(fmt.Sprintf("name: app\nport: %d\n", port)), 0644))
+		git("add", "-A")
+		git("commit", "-q", "-m", msg)
+	}
+
+	git("init", "-q")
+	commitConfig(1, "first")
+	firstCommit := git("rev-parse", "HEAD")
+	commitConfig(2, "second")
+	git("tag", "v1.4.2")
+	commitConfig(3, "third")
+
+	type cfg struct {
+		Name string `config:"required"`
+		Port int
+	}
+
+	var resolved []string
+	source := &GitSource{
+		OnResolve: func(url string, commit string) {
+			resolved = append(resolved, commit)
+		},
+	}
+	loader := NewLoader()
+	loader.RegisterSource(source)
+	loader.RegisterUnmarshaller(DefaultYAMLUnmarshaller)
+
+	tests := []struct {
+		query string
+		port  int
+	}{
+		{"", 3},
+		{"?ref=v1.4.2", 2},
+		{"?ref=" + firstCommit, 1},
+		{"?ref=" + firstCommit[:8], 1},
+		{"?ref=HEAD~1", 2},
+	}
+	for _, tt := range tests {
+		url := fmt.Sprintf("git://%s%s#envs/prod.yaml", dir, tt.query)
+		actCfg := new(cfg)
+		require.NoError(t, loader.LoadURL(url, actCfg), url)
+		require.Equal(t, "app", actCfg.Name, url)
+		require.Equal(t, tt.port, actCfg.Port, url)
+	}
+	require.Len(t, resolved, len(tests))
+	require.Equal(t, firstCommit, resolved[2])
+
+	_, err = source.Reader(fmt.Sprintf("git://%s?ref=v9.9.9#envs/prod.yaml", dir))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "error resolving ref v9.9.9")
+
+	_, err = source.Reader(fmt.Sprintf("git://%s#envs/missing.yaml", dir))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "error reading envs/missing.yaml at HEAD")
+
+	_, err = source.Reader(fmt.Sprintf("git://%s?ref=--output=/tmp/x#envs/prod.yaml", dir))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid git ref")
+}
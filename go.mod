@@ -1,9 +1,11 @@
 module configurer
 
-go 1.13
+go 1.16
 
 require (
 	github.com/BurntSushi/toml v0.3.1
+	github.com/hashicorp/hcl v1.0.0
+	github.com/klauspost/compress v1.13.6
 	github.com/pkg/errors v0.9.1
 	github.com/stretchr/testify v1.5.1
 	gopkg.in/yaml.v2 v2.2.2
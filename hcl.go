@@ -0,0 +1,114 @@
+package configurer
+
+import (
+	"fmt"
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	hcltoken "github.com/hashicorp/hcl/hcl/token"
+	"reflect"
+	"strings"
+)
+
+const HCL = "hcl"
+
+// HCLUnmarshaller decodes HCL (version 1) configs. Blocks populate nested
+// structs, repeated blocks populate slices of structs, and labelled blocks
+// populate maps keyed by their labels.
+type HCLUnmarshaller struct {
+}
+
+var DefaultHCLUnmarshaller = new(HCLUnmarshaller)
+
+func (h *HCLUnmarshaller) Extensions() []string {
+	return []string{HCL}
+}
+
+func (h *HCLUnmarshaller) ExtractFieldName(field reflect.StructField) string {
+	tag := field.Tag.Get("hcl")
+	if tag == "" {
+		return field.Name
+	}
+	tagFields := strings.Split(tag, ",")
+	if tagFields[0] == "" {
+		return field.Name
+	}
+	return tagFields[0]
+}
+
+// Unmarshal decodes data through its key map, since HCL's own decoder can't
+// populate unsigned integers.
+func (h *HCLUnmarshaller) Unmarshal(data []byte, v interface{}) error {
+	file, err := hcl.ParseBytes(data)
+	if err != nil {
+		return err
+	}
+	list, ok := file.Node.(*ast.ObjectList)
+	if !ok {
+		return fmt.Errorf("expected an object at the top level but got %T", file.Node)
+	}
+	keyMap := h.objectMap(list)
+	if mapPtr, ok := v.(*map[string]interface{}); ok {
+		*mapPtr = keyMap
+		return nil
+	}
+	return decodeKeyMap(keyMap, v, h.ExtractFieldName)
+}
+
+// objectMap builds a key map from the items of an HCL object. Block labels
+// become nested keys, so that upstream "api" { ... } populates the api entry
+// of a map. An unlabelled block that appears once becomes a map, lining up
+// with a nested struct, while repeated ones become a list.
+func (h *HCLUnmarshaller) objectMap(list *ast.ObjectList) map[string]interface{} {
+	res := make(map[string]interface{})
+	repeated := make(map[string]bool)
+	for _, item := range list.Items {
+		keys := make([]string, len(item.Keys))
+		for i, key := range item.Keys {
+			keys[i] = key.Token.Text
+			if key.Token.Type == hcltoken.STRING {
+				keys[i] = key.Token.Value().(string)
+			}
+		}
+		val := h.value(item.Val)
+
+		if len(keys) > 1 {
+			labelled := make(map[string]interface{})
+			setKeyMapPath(labelled, keys, val)
+			mergeKeyMaps(res, labelled)
+			continue
+		}
+		key := keys[0]
+		existing, exists := res[key]
+		if _, isBlock := item.Val.(*ast.ObjectType); isBlock && exists {
+			// Assignments and labelled blocks can replace a list of blocks,
+			// so the entry is only appended to if it's still a list.
+			if items, isList := existing.([]interface{}); isList && repeated[key] {
+				res[key] = append(items, val)
+			} else {
+				res[key] = []interface{}{existing, val}
+				repeated[key] = true
+			}
+			continue
+		}
+		res[key] = val
+		delete(repeated, key)
+	}
+	return res
+}
+
+func (h *HCLUnmarshaller) value(node ast.Node) interface{} {
+	switch node := node.(type) {
+	case *ast.ObjectType:
+		return h.objectMap(node.List)
+	case *ast.ListType:
+		res := make([]interface{}, len(node.List))
+		for i, item := range node.List {
+			res[i] = h.value(item)
+		}
+		return res
+	case *ast.LiteralType:
+		return node.Token.Value()
+	default:
+		return nil
+	}
+}
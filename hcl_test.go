@@ -0,0 +1,76 @@
+package configurer
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestHCLUnmarshaller(t *testing.T) {
+	type upstream struct {
+		Port    int    `hcl:"port"`
+		Address string `hcl:"address" config:"default=127.0.0.1"`
+	}
+	type cfg struct {
+		Name      string              `hcl:"name" config:"required"`
+		Timeout   string              `hcl:"timeout" config:"default=30s"`
+		MaxBody   int64               `hcl:"max_body"`
+		Upstreams map[string]upstream `hcl:"upstream"`
+		Listeners []struct {
+			Port int `hcl:"port" config:"required"`
+		} `hcl:"listener"`
+	}
+
+	loader := NewLoader()
+	loader.RegisterSource(DefaultMemorySource)
+	loader.RegisterUnmarshaller(DefaultHCLUnmarshaller)
+
+	DefaultMemorySource.Set("app.hcl", []byte(`
+name = "app"
+max_body = 9007199254740993
+
+upstream "api" {
+  port = 8080
+}
+
+upstream "db" {
+  port    = 5432
+  address = "db.internal"
+}
+
+upstream "Auth" {
+  port = 9000
+}
+
+listener {
+  port = 80
+}
+`))
+	defer DefaultMemorySource.Delete("app.hcl")
+
+	actCfg := new(cfg)
+	require.NoError(t, loader.LoadURL("mem://app.hcl", actCfg))
+	require.Equal(t, "app", actCfg.Name)
+	require.Equal(t, "30s", actCfg.Timeout)
+	require.Equal(t, int64(9007199254740993), actCfg.MaxBody)
+	require.Equal(t, map[string]upstream{
+		"api":  {Port: 8080},
+		"db":   {Port: 5432, Address: "db.internal"},
+		"Auth": {Port: 9000},
+	}, actCfg.Upstreams)
+	require.Len(t, actCfg.Listeners, 1)
+	require.Equal(t, 80, actCfg.Listeners[0].Port)
+
+	DefaultMemorySource.Set("app.hcl", []byte(`listener {}`))
+	err := loader.LoadURL("mem://app.hcl", new(cfg))
+	require.Error(t, err)
+
+	DefaultMemorySource.Set("app.hcl", []byte(`name = "app`))
+	err = loader.LoadURL("mem://app.hcl", new(cfg))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "error unmarshalling config")
+
+	// An assignment replaces a list of repeated blocks.
+	var keyMap map[string]interface{}
+	require.NoError(t, DefaultHCLUnmarshaller.Unmarshal([]byte("b {}\nb {}\nb = 1\nb {}"), &keyMap))
+	require.Equal(t, []interface{}{int64(1), map[string]interface{}{}}, keyMap["b"])
+}
@@ -0,0 +1,176 @@
+package configurer
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const INI = "ini"
+
+// INIUnmarshaller decodes INI configs. Keys before the first section are
+// top-level fields, and a [section] populates the nested struct of the same
+// name, with dots nesting further, so [database.replica] populates
+// Database.Replica. Sections named by an index, such as [servers.0], populate
+// slices of structs. Section and key names are case-insensitive, although
+// keys that populate a map keep the case they were first written in.
+//
+// Lines starting with ; or # are comments, as is anything after a ; or # that
+// follows whitespace in an unquoted value. Values may be wrapped in double
+// quotes, which support Go escape sequences, or single quotes, which are
+// taken literally. A key that's repeated within a section populates a slice.
+type INIUnmarshaller struct {
+}
+
+var DefaultINIUnmarshaller = new(INIUnmarshaller)
+
+func (i *INIUnmarshaller) Extensions() []string {
+	return []string{INI, "cfg"}
+}
+
+func (i *INIUnmarshaller) ExtractFieldName(field reflect.StructField) string {
+	tag := field.Tag.Get("ini")
+	if tag == "" {
+		return field.Name
+	}
+	tagFields := strings.Split(tag, ",")
+	if tagFields[0] == "" {
+		return field.Name
+	}
+	return tagFields[0]
+}
+
+func (i *INIUnmarshaller) Unmarshal(data []byte, v interface{}) error {
+	keyMap, err := i.parse(data)
+	if err != nil {
+		return err
+	}
+	if mapPtr, ok := v.(*map[string]interface{}); ok {
+		*mapPtr = keyMap
+		return nil
+	}
+	return decodeKeyMap(keyMap, v, i.ExtractFieldName)
+}
+
+func (i *INIUnmarshaller) parse(data []byte) (map[string]interface{}, error) {
+	keyMap := make(map[string]interface{})
+	section := keyMap
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if lineNum == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+
+		if line[0] == '[' {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: section header is missing a closing ]", lineNum)
+			}
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if name == "" {
+				return nil, fmt.Errorf("line %d: section name is empty", lineNum)
+			}
+			section = keyMap
+			for _, part := range strings.Split(name, ".") {
+				part = strings.TrimSpace(part)
+				_, existing, _ := lookupKeyMap(section, part)
+				switch next := existing.(type) {
+				case nil:
+					created := make(map[string]interface{})
+					section[part] = created
+					section = created
+				case map[string]interface{}:
+					section = next
+				default:
+					return nil, fmt.Errorf("line %d: section %s is also a key", lineNum, name)
+				}
+			}
+			continue
+		}
+
+		sepIdx := strings.IndexAny(line, "=:")
+		if sepIdx == -1 {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNum)
+		}
+		key := strings.TrimSpace(line[:sepIdx])
+		if key == "" {
+			return nil, fmt.Errorf("line %d: key is empty", lineNum)
+		}
+		value, err := i.parseValue(strings.TrimSpace(line[sepIdx+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+
+		existingKey, existing, ok := lookupKeyMap(section, key)
+		if ok {
+			key = existingKey
+		}
+		switch existing := existing.(type) {
+		case nil:
+			section[key] = value
+		case []interface{}:
+			section[key] = append(existing, value)
+		case string:
+			section[key] = []interface{}{existing, value}
+		default:
+			return nil, fmt.Errorf("line %d: key %s is also a section", lineNum, key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return keyMap, nil
+}
+
+func (i *INIUnmarshaller) parseValue(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+	switch raw[0] {
+	case '"':
+		end := i.closingQuote(raw)
+		if end == -1 {
+			return "", fmt.Errorf("unterminated quoted value %s", raw)
+		}
+		if rest := strings.TrimSpace(raw[end+1:]); rest != "" && rest[0] != ';' && rest[0] != '#' {
+			return "", fmt.Errorf("unexpected %s after quoted value", rest)
+		}
+		return strconv.Unquote(raw[:end+1])
+	case '\'':
+		end := strings.IndexByte(raw[1:], '\'')
+		if end == -1 {
+			return "", fmt.Errorf("unterminated quoted value %s", raw)
+		}
+		if rest := strings.TrimSpace(raw[end+2:]); rest != "" && rest[0] != ';' && rest[0] != '#' {
+			return "", fmt.Errorf("unexpected %s after quoted value", rest)
+		}
+		return raw[1 : end+1], nil
+	}
+
+	for idx := 1; idx < len(raw); idx++ {
+		if (raw[idx] == ';' || raw[idx] == '#') && (raw[idx-1] == ' ' || raw[idx-1] == '\t') {
+			return strings.TrimSpace(raw[:idx]), nil
+		}
+	}
+	return raw, nil
+}
+
+// closingQuote returns the index of the double quote that ends the quoted
+// string at the start of raw, skipping escaped quotes.
+func (i *INIUnmarshaller) closingQuote(raw string) int {
+	for idx := 1; idx < len(raw); idx++ {
+		switch raw[idx] {
+		case '\\':
+			idx++
+		case '"':
+			return idx
+		}
+	}
+	return -1
+}
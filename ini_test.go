@@ -0,0 +1,83 @@
+package configurer
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestINIUnmarshaller(t *testing.T) {
+	type cfg struct {
+		Name     string `ini:"app_name" config:"required"`
+		Greeting string
+		Path     string
+		Database struct {
+			Host    string `config:"default=localhost"`
+			Port    int
+			Replica struct {
+				Host string
+			}
+		}
+		Servers struct {
+			Hosts []string
+		}
+		Labels map[string]string
+	}
+
+	actCfg := new(cfg)
+	require.NoError(t, DefaultINIUnmarshaller.Unmarshal([]byte(`
+; application settings
+app_name = app
+greeting = "hello \"world\"\t; not a comment" ; a comment
+path: 'C:\configs\app'
+
+[database]
+port = 5432 # a comment
+
+[Database.Replica]
+host = replica.internal
+
+[servers]
+hosts = a
+Hosts = b
+
+[labels]
+Team = payments
+`), actCfg))
+	require.Equal(t, "app", actCfg.Name)
+	require.Equal(t, "hello \"world\"\t; not a comment", actCfg.Greeting)
+	require.Equal(t, `C:\configs\app`, actCfg.Path)
+	require.Equal(t, 5432, actCfg.Database.Port)
+	require.Equal(t, "replica.internal", actCfg.Database.Replica.Host)
+	require.Equal(t, []string{"a", "b"}, actCfg.Servers.Hosts)
+	require.Equal(t, map[string]string{"Team": "payments"}, actCfg.Labels)
+
+	loader := NewLoader()
+	loader.RegisterSource(DefaultMemorySource)
+	loader.RegisterUnmarshaller(DefaultINIUnmarshaller)
+	DefaultMemorySource.Set("app.cfg", []byte("app_name = app\n[servers]\nhosts = a\n"))
+	defer DefaultMemorySource.Delete("app.cfg")
+	actCfg = new(cfg)
+	require.NoError(t, loader.LoadURL("mem://app.cfg", actCfg))
+	require.Equal(t, "localhost", actCfg.Database.Host)
+	require.Equal(t, []string{"a"}, actCfg.Servers.Hosts)
+
+	DefaultMemorySource.Set("app.cfg", []byte("[database]\nport = 5432\n"))
+	err := loader.LoadURL("mem://app.cfg", new(cfg))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "required field Name not found")
+
+	for input, msg := range map[string]string{
+		"app_name = app\n[database\n":             "line 2: section header is missing a closing ]",
+		"app_name\n":                              "line 1: expected key = value",
+		"\n\n = app\n":                            "line 3: key is empty",
+		"greeting = \"hello\n":                    "line 1: unterminated quoted value",
+		"greeting = \"hello\" world\n":            "line 1: unexpected world after quoted value",
+		"database = x\n[database]\n":              "line 2: section database is also a key",
+		"[database]\n[]\n":                        "line 2: section name is empty",
+		"[database.port]\n[database]\nport = 1\n": "line 3: key port is also a section",
+	} {
+		err := DefaultINIUnmarshaller.Unmarshal([]byte(input), new(map[string]interface{}))
+		require.Error(t, err, input)
+		require.Contains(t, err.Error(), msg)
+	}
+}
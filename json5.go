@@ -0,0 +1,235 @@
+package configurer
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"unicode/utf8"
+)
+
+const (
+	JSONC = "jsonc"
+	JSON5 = "json5"
+)
+
+// JSON5Unmarshaller decodes JSON configs that use the most common JSON5
+// extensions: // and /* */ comments, trailing commas, unquoted keys and
+// single-quoted strings. The config is translated to plain JSON and decoded
+// with encoding/json, so fields are matched by their json tags, and errors
+// point at the line and column of the original config.
+type JSON5Unmarshaller struct {
+}
+
+var DefaultJSON5Unmarshaller = new(JSON5Unmarshaller)
+
+func (j *JSON5Unmarshaller) Extensions() []string {
+	return []string{JSONC, JSON5}
+}
+
+func (j *JSON5Unmarshaller) ExtractFieldName(field reflect.StructField) string {
+	return DefaultJSONUnmarshaller.ExtractFieldName(field)
+}
+
+func (j *JSON5Unmarshaller) Unmarshal(data []byte, v interface{}) error {
+	translated, offsets, err := j.translate(data)
+	if err != nil {
+		return err
+	}
+	err = unmarshalJSON(translated, v)
+	if err == nil {
+		return nil
+	}
+
+	var offset int64
+	switch jsonErr := err.(type) {
+	case *json.SyntaxError:
+		offset = jsonErr.Offset - 1
+		if jsonErr.Offset >= int64(len(translated)) {
+			// Point past the end of the config for unexpected ends.
+			offset = int64(len(offsets))
+		}
+	case *json.UnmarshalTypeError:
+		offset = jsonErr.Offset - 1
+	default:
+		return err
+	}
+	pos := len(data)
+	if offset < 0 {
+		pos = 0
+	} else if offset < int64(len(offsets)) {
+		pos = offsets[offset]
+	}
+	return j.errorAt(data, pos, err.Error())
+}
+
+// translate converts data to plain JSON. offsets maps each byte of the
+// result to the offset of the byte in data it came from.
+func (j *JSON5Unmarshaller) translate(data []byte) ([]byte, []int, error) {
+	out := make([]byte, 0, len(data))
+	offsets := make([]int, 0, len(data))
+	emit := func(b byte, pos int) {
+		out = append(out, b)
+		offsets = append(offsets, pos)
+	}
+
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c == '/' && i+1 < len(data) && (data[i+1] == '/' || data[i+1] == '*'):
+			end, err := j.skipComment(data, i)
+			if err != nil {
+				return nil, nil, err
+			}
+			// Keep the tokens on either side of the comment apart.
+			emit(' ', i)
+			i = end - 1
+		case c == '"':
+			end, err := j.stringEnd(data, i)
+			if err != nil {
+				return nil, nil, err
+			}
+			for k := i; k < end; k++ {
+				emit(data[k], k)
+			}
+			i = end - 1
+		case c == '\'':
+			end, err := j.stringEnd(data, i)
+			if err != nil {
+				return nil, nil, err
+			}
+			emit('"', i)
+			for k := i + 1; k < end-1; k++ {
+				switch {
+				case data[k] == '\\' && data[k+1] == '\'':
+					emit('\'', k)
+					k++
+				case data[k] == '\\':
+					emit(data[k], k)
+					emit(data[k+1], k+1)
+					k++
+				case data[k] == '"':
+					emit('\\', k)
+					emit('"', k)
+				default:
+					emit(data[k], k)
+				}
+			}
+			emit('"', end-1)
+			i = end - 1
+		case c == ',':
+			next, err := j.skipInsignificant(data, i+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			if next < len(data) && (data[next] == '}' || data[next] == ']') {
+				// Drop trailing commas.
+				continue
+			}
+			emit(c, i)
+		case j.isIdentStart(c):
+			end := i + 1
+			for end < len(data) && j.isIdentPart(data[end]) {
+				end++
+			}
+			ident := string(data[i:end])
+			next, err := j.skipInsignificant(data, end)
+			if err != nil {
+				return nil, nil, err
+			}
+			quote := ident != "true" && ident != "false" && ident != "null" && next < len(data) && data[next] == ':'
+			if quote {
+				emit('"', i)
+			}
+			for k := i; k < end; k++ {
+				emit(data[k], k)
+			}
+			if quote {
+				emit('"', end-1)
+			}
+			i = end - 1
+		default:
+			emit(c, i)
+		}
+	}
+	return out, offsets, nil
+}
+
+// skipComment returns the offset just past the comment starting at start.
+func (j *JSON5Unmarshaller) skipComment(data []byte, start int) (int, error) {
+	if data[start+1] == '/' {
+		for i := start + 2; i < len(data); i++ {
+			if data[i] == '\n' {
+				return i, nil
+			}
+		}
+		return len(data), nil
+	}
+	for i := start + 2; i+1 < len(data); i++ {
+		if data[i] == '*' && data[i+1] == '/' {
+			return i + 2, nil
+		}
+	}
+	return 0, j.errorAt(data, start, "unterminated comment")
+}
+
+// skipInsignificant returns the offset of the next byte at or after start
+// that isn't whitespace or part of a comment.
+func (j *JSON5Unmarshaller) skipInsignificant(data []byte, start int) (int, error) {
+	i := start
+	for i < len(data) {
+		switch {
+		case data[i] == ' ' || data[i] == '\t' || data[i] == '\n' || data[i] == '\r':
+			i++
+		case data[i] == '/' && i+1 < len(data) && (data[i+1] == '/' || data[i+1] == '*'):
+			end, err := j.skipComment(data, i)
+			if err != nil {
+				return 0, err
+			}
+			i = end
+		default:
+			return i, nil
+		}
+	}
+	return i, nil
+}
+
+// stringEnd returns the offset just past the closing quote of the string
+// starting at start.
+func (j *JSON5Unmarshaller) stringEnd(data []byte, start int) (int, error) {
+	quote := data[start]
+	for i := start + 1; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			i++
+		case '\n':
+			return 0, j.errorAt(data, start, "unterminated string")
+		case quote:
+			return i + 1, nil
+		}
+	}
+	return 0, j.errorAt(data, start, "unterminated string")
+}
+
+func (j *JSON5Unmarshaller) isIdentStart(c byte) bool {
+	return c == '_' || c == '$' || 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z'
+}
+
+func (j *JSON5Unmarshaller) isIdentPart(c byte) bool {
+	return j.isIdentStart(c) || '0' <= c && c <= '9'
+}
+
+// errorAt describes an error at offset pos of data by line and column.
+func (j *JSON5Unmarshaller) errorAt(data []byte, pos int, msg string) error {
+	line, col := 1, 1
+	for i := 0; i < pos && i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		if r == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+		i += size
+	}
+	return fmt.Errorf("line %d, column %d: %s", line, col, msg)
+}
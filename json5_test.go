@@ -0,0 +1,61 @@
+package configurer
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestJSON5Unmarshaller(t *testing.T) {
+	type cfg struct {
+		Name     string `json:"name" config:"required"`
+		Quote    string `json:"quote"`
+		Path     string `json:"path"`
+		URL      string `json:"url"`
+		Port     int    `json:"port" config:"default=8080"`
+		Nullable *string
+	}
+
+	actCfg := new(cfg)
+	require.NoError(t, DefaultJSON5Unmarshaller.Unmarshal([]byte(`{
+  // comments can go anywhere
+  name: 'app', /* even here */
+  quote: 'it\'s "quoted"',
+  path: 'C:\\configs',
+  "url": "http://example.com/*not-a-comment*/",
+  $Nullable: null,
+  Nullable /* before the colon */ : null,
+}`), actCfg))
+	require.Equal(t, "app", actCfg.Name)
+	require.Equal(t, `it's "quoted"`, actCfg.Quote)
+	require.Equal(t, `C:\configs`, actCfg.Path)
+	require.Equal(t, "http://example.com/*not-a-comment*/", actCfg.URL)
+	require.Nil(t, actCfg.Nullable)
+
+	loader := NewLoader()
+	loader.RegisterSource(DefaultMemorySource)
+	loader.RegisterUnmarshaller(DefaultJSON5Unmarshaller)
+	DefaultMemorySource.Set("app.jsonc", []byte("// tsconfig-style\n{\"name\": \"app\",}\n"))
+	defer DefaultMemorySource.Delete("app.jsonc")
+	actCfg = new(cfg)
+	require.NoError(t, loader.LoadURL("mem://app.jsonc", actCfg))
+	require.Equal(t, "app", actCfg.Name)
+	require.Equal(t, 8080, actCfg.Port)
+
+	DefaultMemorySource.Set("app.jsonc", []byte("{\n  // no name\n  port: 1,\n}"))
+	err := loader.LoadURL("mem://app.jsonc", new(cfg))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "required field Name not found")
+
+	for input, msg := range map[string]string{
+		"{\n  name: 'app'\n  port: 1\n}":      "line 3, column 3: invalid character '\"' after object key:value pair",
+		"{\n  // comment\n  port: 'x',\n}":    "line 3, column 11: json: cannot unmarshal string into Go struct field cfg.port of type int",
+		"{\n  name: 'app\n}":                  "line 2, column 9: unterminated string",
+		"{\n  name: 'app' /* unterminated\n}": "line 2, column 15: unterminated comment",
+		"{\n  name: 'café', port: x\n}":       "line 2, column 23: invalid character 'x' looking for beginning of value",
+		"{\n  name: 'app',\n":                 "line 3, column 1: unexpected end of JSON input",
+	} {
+		err := DefaultJSON5Unmarshaller.Unmarshal([]byte(input), new(cfg))
+		require.Error(t, err, input)
+		require.Contains(t, err.Error(), msg, input)
+	}
+}
@@ -0,0 +1,307 @@
+package configurer
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// mergeKeyMaps deep-merges src into dst. Nested maps are merged key by key;
+// any other value in src replaces the one in dst. Keys are matched the same
+// way as lookupKeyMap does, and a replaced value takes the key's spelling
+// from src.
+func mergeKeyMaps(dst, src map[string]interface{}) {
+	for k, srcVal := range src {
+		dstKey, dstVal, dstIsDefined := lookupKeyMap(dst, k)
+		srcMap, srcIsMap := srcVal.(map[string]interface{})
+		dstMap, dstIsMap := dstVal.(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			mergeKeyMaps(dstMap, srcMap)
+			continue
+		}
+		if dstIsDefined {
+			delete(dst, dstKey)
+		}
+		dst[k] = srcVal
+	}
+}
+
+// lookupKeyMap returns the key and value in keyMap for a field name. Keys
+// match case-insensitively, since config files rarely follow Go's casing,
+// but an exact match is preferred. Only field names are matched this way;
+// the keys of maps decoded from a key map keep their original case.
+func lookupKeyMap(keyMap map[string]interface{}, name string) (string, interface{}, bool) {
+	if val, ok := keyMap[name]; ok {
+		return name, val, true
+	}
+	keys := make([]string, 0, len(keyMap))
+	for k := range keyMap {
+		if strings.EqualFold(k, name) {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return "", nil, false
+	}
+	sort.Strings(keys)
+	return keys[0], keyMap[keys[0]], true
+}
+
+// setKeyMapPath stores val in m under the nested key described by path,
+// creating intermediate maps as needed. Keys are matched the same way as
+// lookupKeyMap does, so that paths differing only in case end up in the same
+// place.
+func setKeyMapPath(m map[string]interface{}, path []string, val interface{}) {
+	for _, key := range path[:len(path)-1] {
+		existingKey, existing, ok := lookupKeyMap(m, key)
+		next, isMap := existing.(map[string]interface{})
+		if !isMap {
+			if ok {
+				delete(m, existingKey)
+			}
+			next = make(map[string]interface{})
+			m[key] = next
+		}
+		m = next
+	}
+	key := path[len(path)-1]
+	if existingKey, _, ok := lookupKeyMap(m, key); ok {
+		delete(m, existingKey)
+	}
+	m[key] = val
+}
+
+// keyMapNumbers replaces the json.Numbers in a key map decoded with
+// json.Decoder.UseNumber by int64s if they're integers and float64s
+// otherwise, so that large integers don't lose precision.
+func keyMapNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = keyMapNumbers(item)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = keyMapNumbers(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func encodeKeyMap(m map[string]interface{}) (io.ReadCloser, error) {
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return nil, errors.Wrap(err, "error encoding key map")
+	}
+	return ioutil.NopCloser(bytes.NewReader(buf)), nil
+}
+
+// keyMapItems returns the elements of a key map value that should populate a
+// slice. Maps whose keys are all indices (as produced by sources that build
+// key maps from flat keys like hosts.0) are ordered by index; any other
+// value that isn't a slice is treated as a list with a single item.
+func keyMapItems(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	case map[string]interface{}:
+		indices := make([]int, 0, len(v))
+		byIndex := make(map[int]interface{})
+		for k, item := range v {
+			idx, err := strconv.Atoi(k)
+			if err != nil || idx < 0 {
+				return []interface{}{v}
+			}
+			indices = append(indices, idx)
+			byIndex[idx] = item
+		}
+		sort.Ints(indices)
+		res := make([]interface{}, len(indices))
+		for i, idx := range indices {
+			res[i] = byIndex[idx]
+		}
+		return res
+	default:
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return []interface{}{v}
+		}
+		res := make([]interface{}, rv.Len())
+		for i := range res {
+			res[i] = rv.Index(i).Interface()
+		}
+		return res
+	}
+}
+
+// decodeKeyMap populates v from a key map. Unlike the format-specific
+// unmarshallers, scalar values are converted as needed: strings are parsed
+// the same way default values and environment overrides are, and numbers or
+// booleans can populate string fields.
+func decodeKeyMap(keyMap map[string]interface{}, v interface{}, fieldName func(field reflect.StructField) string) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("can only decode into a non-nil pointer, but got %T", v)
+	}
+	return decodeKeyMapValue(keyMap, rv.Elem(), fieldName)
+}
+
+func decodeKeyMapValue(in interface{}, out reflect.Value, fieldName func(field reflect.StructField) string) error {
+	if in == nil {
+		return nil
+	}
+
+	inVal := reflect.ValueOf(in)
+	if inVal.Type().AssignableTo(out.Type()) {
+		out.Set(inVal)
+		return nil
+	}
+
+	if out.Kind() == reflect.Ptr {
+		if out.IsNil() {
+			out.Set(reflect.New(out.Type().Elem()))
+		}
+		return decodeKeyMapValue(in, out.Elem(), fieldName)
+	}
+
+	if str, ok := in.(string); ok && out.CanAddr() {
+		if unmarshaler, ok := out.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return unmarshaler.UnmarshalText([]byte(str))
+		}
+	}
+
+	switch out.Kind() {
+	case reflect.Interface:
+		if out.NumMethod() != 0 {
+			return fmt.Errorf("can't decode into non-empty interface %s", out.Type())
+		}
+		out.Set(inVal)
+		return nil
+	case reflect.Struct:
+		keyMap, ok := in.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected a map but got %T", in)
+		}
+		return decodeKeyMapStruct(keyMap, out, fieldName)
+	case reflect.Map:
+		keyMap, ok := in.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected a map but got %T", in)
+		}
+		if out.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("can only decode into maps with string keys, but got %s", out.Type())
+		}
+		if out.IsNil() {
+			out.Set(reflect.MakeMap(out.Type()))
+		}
+		for k, v := range keyMap {
+			elem := reflect.New(out.Type().Elem()).Elem()
+			if err := decodeKeyMapValue(v, elem, fieldName); err != nil {
+				return errors.Wrap(err, fmt.Sprintf("error decoding key %s", k))
+			}
+			out.SetMapIndex(reflect.ValueOf(k).Convert(out.Type().Key()), elem)
+		}
+		return nil
+	case reflect.Slice, reflect.Array:
+		if str, ok := in.(string); ok {
+			if out.Kind() == reflect.Slice && out.Type().Elem().Kind() == reflect.Uint8 {
+				out.SetBytes([]byte(str))
+				return nil
+			}
+			// Strings that aren't YAML lists, such as a key that appears
+			// only once in formats that repeat keys to build lists,
+			// populate a single item.
+			if err := decodeKeyMapScalar(str, out); err == nil {
+				return nil
+			}
+			in = []interface{}{str}
+		}
+		items := keyMapItems(in)
+		if out.Kind() == reflect.Slice {
+			out.Set(reflect.MakeSlice(out.Type(), len(items), len(items)))
+		} else if len(items) > out.Len() {
+			return fmt.Errorf("expected at most %d items but got %d", out.Len(), len(items))
+		}
+		for i, item := range items {
+			if err := decodeKeyMapValue(item, out.Index(i), fieldName); err != nil {
+				return errors.Wrap(err, fmt.Sprintf("error decoding index %d", i))
+			}
+		}
+		return nil
+	default:
+		return decodeKeyMapScalar(in, out)
+	}
+}
+
+func decodeKeyMapStruct(keyMap map[string]interface{}, out reflect.Value, fieldName func(field reflect.StructField) string) error {
+	outType := out.Type()
+	for i := 0; i < outType.NumField(); i++ {
+		fieldDef := outType.Field(i)
+		if fieldDef.PkgPath != "" {
+			continue
+		}
+		name := fieldName(fieldDef)
+		if name == "-" {
+			continue
+		}
+		_, rawFieldVal, ok := lookupKeyMap(keyMap, name)
+		if !ok {
+			continue
+		}
+		if err := decodeKeyMapValue(rawFieldVal, out.Field(i), fieldName); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("error decoding field %s", fieldDef.Name))
+		}
+	}
+	return nil
+}
+
+func decodeKeyMapScalar(in interface{}, out reflect.Value) error {
+	var text string
+	switch in := in.(type) {
+	case string:
+		text = in
+	case float64:
+		text = strconv.FormatFloat(in, 'f', -1, 64)
+	case float32:
+		text = strconv.FormatFloat(float64(in), 'f', -1, 32)
+	case encoding.TextMarshaler:
+		buf, err := in.MarshalText()
+		if err != nil {
+			return err
+		}
+		text = string(buf)
+	case map[string]interface{}, []interface{}:
+		return fmt.Errorf("expected a scalar but got %T", in)
+	default:
+		text = fmt.Sprint(in)
+	}
+
+	if out.Kind() == reflect.String {
+		out.SetString(text)
+		return nil
+	}
+	if !out.CanAddr() {
+		return fmt.Errorf("can't decode into unaddressable %s", out.Type())
+	}
+	return yaml.Unmarshal([]byte(text), out.Addr().Interface())
+}
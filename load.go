@@ -1,55 +1,177 @@
 package configurer
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"github.com/pkg/errors"
 	"io"
 	"io/ioutil"
+	"reflect"
 	"strings"
+	"time"
 )
 
 type Loader struct {
-	sources      map[string]Source
-	unmarshalers map[string]Unmarshaller
+	sources       map[string]Source
+	unmarshalers  map[string]Unmarshaller
+	verifiers     []Verifier
+	decrypters    []Decrypter
+	decompressors map[string]Decompressor
 }
 
 func NewLoader() *Loader {
 	return &Loader{
-		sources:      make(map[string]Source),
-		unmarshalers: make(map[string]Unmarshaller),
+		sources:       make(map[string]Source),
+		unmarshalers:  make(map[string]Unmarshaller),
+		decompressors: make(map[string]Decompressor),
 	}
 }
 
 func (l *Loader) LoadURL(url string, v interface{}) error {
-	protoIdx := strings.Index(url, "://")
-	if protoIdx == -1 {
-		return errors.New("url should start with some protocol")
+	buf, unmarshaller, commit, err := l.fetchURL(url)
+	if err != nil {
+		return err
 	}
-	proto := url[:protoIdx]
-	source := l.sources[proto]
-	if source == nil {
-		return fmt.Errorf("can't find source for protocol %s - try registering one", proto)
+	if err := l.unmarshal(buf, unmarshaller, v); err != nil {
+		return err
 	}
+	commit()
+	return nil
+}
 
-	extIdx := strings.LastIndex(url, ".")
-	if extIdx == -1 {
-		return errors.New("url does not have a detectable file extension. please either add one or force a config type")
+// LoadURLs loads several URLs into v as layers, e.g. defaults embedded in the
+// binary followed by a file on disk. The layers are deep-merged in order, so
+// values from later URLs override earlier ones, and tags are processed
+// against the merged result. Like DirSource, fields are matched the same way
+// as DefaultKeyMapUnmarshaller does.
+func (l *Loader) LoadURLs(v interface{}, urls ...string) error {
+	merged := make(map[string]interface{})
+	var commits []func()
+	for _, url := range urls {
+		buf, unmarshaller, commit, err := l.fetchURL(url)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("error loading layer %s", url))
+		}
+		keyMap, err := l.unmarshalKeyMap(buf, unmarshaller)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("error loading layer %s", url))
+		}
+		mergeKeyMaps(merged, keyMap)
+		commits = append(commits, commit)
+	}
+	// The merged map is decoded as is, rather than re-encoded, so that the
+	// layers aren't decrypted twice and integers keep their precision.
+	if err := decodeKeyMap(merged, v, DefaultKeyMapUnmarshaller.ExtractFieldName); err != nil {
+		return errors.Wrap(err, "error unmarshalling config")
+	}
+	if err := processTags(v, DefaultKeyMapUnmarshaller, merged); err != nil {
+		return err
 	}
-	if extIdx == len(url)-1 {
-		return errors.New("url ends in a dot, but doesn't have a detectable file extension. please either add one or force a config type")
+	for _, commit := range commits {
+		commit()
 	}
-	ext := url[extIdx+1:]
+	return nil
+}
 
-	unmarshaller := l.unmarshalers[ext]
-	if unmarshaller == nil {
-		return fmt.Errorf("can't find unmarshaller for extension %s - try registering one", ext)
+// LoadURLFirst tries each URL in order and loads the first one that can be
+// fetched and passes validation into v, e.g. a primary config server
+// followed by a mirror and a local file. Each candidate is loaded into a
+// fresh value, so a failed candidate never leaves v half-populated. If every
+// candidate fails, the returned error is a URLErrors describing why.
+func (l *Loader) LoadURLFirst(v interface{}, urls ...string) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("can only load into a non-nil pointer, but got %T", v)
+	}
+	if len(urls) == 0 {
+		return errors.New("no URLs to load")
 	}
 
-	r, err := source.Reader(url)
+	var errs URLErrors
+	for _, url := range urls {
+		candidate := reflect.New(rv.Type().Elem())
+		if err := l.LoadURL(url, candidate.Interface()); err != nil {
+			errs = append(errs, &URLError{
+				URL: url,
+				Err: err,
+			})
+			continue
+		}
+		rv.Elem().Set(candidate.Elem())
+		return nil
+	}
+	return errs
+}
+
+// URLError records why loading a single URL failed.
+type URLError struct {
+	URL string
+	Err error
+}
+
+func (u *URLError) Error() string {
+	return fmt.Sprintf("%s: %v", u.URL, u.Err)
+}
+
+func (u *URLError) Unwrap() error {
+	return u.Err
+}
+
+// URLErrors is returned by LoadURLFirst when every URL fails, in the order
+// they were tried.
+type URLErrors []*URLError
+
+func (u URLErrors) Error() string {
+	msgs := make([]string, len(u))
+	for i, err := range u {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("all %d config URLs failed: %s", len(u), strings.Join(msgs, "; "))
+}
+
+// WatchURL loads url into v, then reloads it each time the URL's source
+// reports a change until ctx is done. Reloads decode into a fresh value of
+// v's type, which is passed to fn; if a reload fails, fn is called with a nil
+// value and the error. The source must implement Watcher.
+func (l *Loader) WatchURL(ctx context.Context, url string, v interface{}, fn func(v interface{}, err error)) error {
+	source, err := l.sourceFor(url)
 	if err != nil {
-		return errors.Wrap(err, "error opening config")
+		return err
+	}
+	watcher, ok := source.(Watcher)
+	if !ok {
+		return fmt.Errorf("source for %s does not support watching", url)
+	}
+	if err := l.LoadURL(url, v); err != nil {
+		return err
+	}
+
+	cfgType := reflect.TypeOf(v).Elem()
+	for {
+		if err := watcher.Watch(ctx, url); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, errWatchUnsupported) {
+				return err
+			}
+			fn(nil, errors.Wrap(err, "error watching config"))
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(watchRetryInterval):
+			}
+			continue
+		}
+
+		next := reflect.New(cfgType).Interface()
+		if err := l.LoadURL(url, next); err != nil {
+			fn(nil, err)
+			continue
+		}
+		fn(next, nil)
 	}
-	return l.Load(r, unmarshaller, v)
 }
 
 func (l *Loader) LoadJSON(r io.ReadCloser, v interface{}) error {
@@ -65,13 +187,144 @@ func (l *Loader) LoadYAML(r io.ReadCloser, v interface{}) error {
 }
 
 func (l *Loader) Load(r io.ReadCloser, unmarshaller Unmarshaller, v interface{}) error {
+	buf, err := l.readPayload(r, nil, unmarshaller, func(payload []byte) error {
+		return l.verify("", payload, nil)
+	})
+	if err != nil {
+		return err
+	}
+	return l.unmarshal(buf, unmarshaller, v)
+}
+
+// fetchURL reads and verifies the payload behind url, and picks the
+// unmarshaller for it. Calling commit once the payload has been validated
+// lets the source know it can be relied upon.
+func (l *Loader) fetchURL(url string) ([]byte, Unmarshaller, func(), error) {
+	url = expandStdinURL(url)
+	sourceURL, digest := splitDigestFragment(url)
+	source, err := l.sourceFor(sourceURL)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	formatURL, decompressor := l.decompressorFor(sourceURL)
+	unmarshaller, err := l.unmarshallerFor(source, formatURL)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	synthetic := false
+	if syntheticSource, ok := source.(SyntheticSource); ok {
+		synthetic = syntheticSource.Synthetic(sourceURL)
+	}
+	if synthetic && digest != "" {
+		return nil, nil, nil, errors.New("error verifying config: digests can't be checked against configs assembled by their source")
+	}
+
+	r, err := source.Reader(sourceURL)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "error opening config")
+	}
+	var sidecars []string
+	fetch := func(suffix string) ([]byte, error) {
+		sidecar := sidecarURL(sourceURL, suffix)
+		r, err := source.Reader(sidecar)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		buf, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		sidecars = append(sidecars, sidecar)
+		return buf, nil
+	}
+	verify := func(payload []byte) error {
+		return l.verify(url, payload, fetch)
+	}
+	if synthetic {
+		// There's nothing to check an assembled payload against, so it's
+		// verified like one loaded from a reader, which verifiers that
+		// demand a digest or signature reject. Sources that verified each
+		// part with this loader's verifiers have already done the work.
+		verify = func(payload []byte) error {
+			return l.verify("", payload, nil)
+		}
+		if partVerifier, ok := source.(partVerifier); ok && partVerifier.verifiedBy(l) {
+			verify = nil
+		}
+	}
+	buf, err := l.readPayload(r, decompressor, unmarshaller, verify)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	commit := func() {
+		if committer, ok := source.(committer); ok {
+			committer.commit(sourceURL, sidecars)
+		}
+	}
+	return buf, unmarshaller, commit, nil
+}
+
+// sidecarURL returns the URL of the sidecar file next to the config at url,
+// e.g. s3://bucket/app.yaml.sig?versionId=1 for s3://bucket/app.yaml?versionId=1.
+// Like unmarshallerFor, it treats a fragment after the query as the path.
+func sidecarURL(url string, suffix string) string {
+	queryIdx := strings.Index(url, "?")
+	if queryIdx == -1 || strings.Contains(url[queryIdx:], "#") {
+		return url + suffix
+	}
+	return url[:queryIdx] + suffix + url[queryIdx:]
+}
+
+// verify runs payload, read from url, past the registered verifiers. url and
+// fetch are empty when the payload didn't come from a source.
+func (l *Loader) verify(url string, payload []byte, fetch func(suffix string) ([]byte, error)) error {
+	for _, verifier := range l.verifiers {
+		if err := verifier.Verify(url, payload, fetch); err != nil {
+			return errors.Wrap(err, "error verifying config")
+		}
+	}
+	return nil
+}
+
+// readPayload reads a raw config payload and runs it past verify, then
+// decompresses and decrypts it for unmarshaller. verify is nil for payloads
+// that can't be verified.
+func (l *Loader) readPayload(r io.ReadCloser, decompressor Decompressor, unmarshaller Unmarshaller, verify func(payload []byte) error) ([]byte, error) {
 	buf, err := ioutil.ReadAll(r)
 	if err != nil {
-		return errors.Wrap(err, "error reading config")
+		return nil, errors.Wrap(err, "error reading config")
 	}
 	if err := r.Close(); err != nil {
-		return errors.Wrap(err, "error closing reader")
+		return nil, errors.Wrap(err, "error closing reader")
+	}
+	if verify != nil {
+		if err := verify(buf); err != nil {
+			return nil, err
+		}
 	}
+	if decompressor != nil {
+		dr, err := decompressor.Decompress(bytes.NewReader(buf))
+		if err != nil {
+			return nil, errors.Wrap(err, "error decompressing config")
+		}
+		buf, err = ioutil.ReadAll(dr)
+		dr.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "error decompressing config")
+		}
+	}
+	for _, decrypter := range l.decrypters {
+		if buf, err = decrypter.Decrypt(buf, unmarshaller); err != nil {
+			return nil, errors.Wrap(err, "error decrypting config")
+		}
+	}
+	return buf, nil
+}
+
+func (l *Loader) unmarshal(buf []byte, unmarshaller Unmarshaller, v interface{}) error {
 	if err := unmarshaller.Unmarshal(buf, v); err != nil {
 		return errors.Wrap(err, "error unmarshalling config")
 	}
@@ -79,38 +332,73 @@ func (l *Loader) Load(r io.ReadCloser, unmarshaller Unmarshaller, v interface{})
 	if err := unmarshaller.Unmarshal(buf, &keyMap); err != nil {
 		return errors.Wrap(err, "error unmarshalling config")
 	}
-	return processTags(v, unmarshaller, l.lowercaseKeyMap(keyMap))
+	return processTags(v, unmarshaller, keyMap)
 }
 
-func (l *Loader) lowercaseKeyMap(m map[string]interface{}) map[string]interface{} {
-	return l.handleMapValue(m).(map[string]interface{})
+// expandStdinURL expands the - shorthand for standard input, e.g. -.yaml, into
+// a stdin:// URL.
+func expandStdinURL(url string) string {
+	if url == "-" || strings.HasPrefix(url, "-.") {
+		return "stdin://" + url
+	}
+	return url
 }
 
-func (l *Loader) handleMapValue(v interface{}) interface{} {
-	switch v := v.(type) {
-	case map[string]interface{}:
-		return l.handleMap(v)
-	case []interface{}:
-		return l.handleSlice(v)
-	default:
-		return v
+func (l *Loader) sourceFor(url string) (Source, error) {
+	protoIdx := strings.Index(url, "://")
+	if protoIdx == -1 {
+		return nil, errors.New("url should start with some protocol")
+	}
+	proto := url[:protoIdx]
+	source := l.sources[proto]
+	if source == nil {
+		return nil, fmt.Errorf("can't find source for protocol %s - try registering one", proto)
 	}
+	return source, nil
 }
 
-func (l *Loader) handleMap(in map[string]interface{}) interface{} {
-	res := make(map[string]interface{})
-	for k, v := range in {
-		res[strings.ToLower(k)] = l.handleMapValue(v)
+func (l *Loader) unmarshallerFor(source Source, url string) (Unmarshaller, error) {
+	if formatSource, ok := source.(FormatSource); ok {
+		if unmarshaller := formatSource.Format(url); unmarshaller != nil {
+			return unmarshaller, nil
+		}
+	}
+	// Query strings aren't part of the path, e.g. in
+	// s3://bucket/config.yaml?versionId=1, but fragments can be, e.g. in
+	// git:///repo?ref=main#config.yaml.
+	if queryIdx := strings.Index(url, "?"); queryIdx != -1 {
+		rest := url[queryIdx:]
+		url = url[:queryIdx]
+		if fragmentIdx := strings.Index(rest, "#"); fragmentIdx != -1 {
+			url += rest[fragmentIdx:]
+		}
 	}
-	return res
+	return l.unmarshallerForPath(url)
 }
 
-func (l *Loader) handleSlice(in []interface{}) []interface{} {
-	res := make([]interface{}, len(in))
-	for i, v := range in {
-		res[i] = l.handleMapValue(v)
+func (l *Loader) unmarshallerForPath(path string) (Unmarshaller, error) {
+	extIdx := strings.LastIndex(path, ".")
+	if extIdx == -1 {
+		return nil, errors.New("url does not have a detectable file extension. please either add one or force a config type")
+	}
+	if extIdx == len(path)-1 {
+		return nil, errors.New("url ends in a dot, but doesn't have a detectable file extension. please either add one or force a config type")
+	}
+	ext := path[extIdx+1:]
+
+	unmarshaller := l.unmarshalers[ext]
+	if unmarshaller == nil {
+		return nil, fmt.Errorf("can't find unmarshaller for extension %s - try registering one", ext)
 	}
-	return res
+	return unmarshaller, nil
+}
+
+func (l *Loader) unmarshalKeyMap(buf []byte, unmarshaller Unmarshaller) (map[string]interface{}, error) {
+	keyMap := make(map[string]interface{})
+	if err := unmarshaller.Unmarshal(buf, &keyMap); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling config")
+	}
+	return keyMap, nil
 }
 
 func (l *Loader) RegisterSource(source Source) {
@@ -123,6 +411,15 @@ func (l *Loader) RegisterSource(source Source) {
 	}
 }
 
+// ReplaceSource registers source, replacing any source already registered
+// for its protocols. It's useful for reconfiguring the sources registered by
+// default, e.g. swapping in an HTTPSource with authentication.
+func (l *Loader) ReplaceSource(source Source) {
+	for _, proto := range source.Protocols() {
+		l.sources[proto] = source
+	}
+}
+
 func (l *Loader) RegisterUnmarshaller(unmarshaller Unmarshaller) {
 	exts := unmarshaller.Extensions()
 	for _, ext := range exts {
@@ -133,12 +430,48 @@ func (l *Loader) RegisterUnmarshaller(unmarshaller Unmarshaller) {
 	}
 }
 
+// RegisterVerifier adds a verifier that every config payload must pass
+// before it's unmarshalled.
+func (l *Loader) RegisterVerifier(verifier Verifier) {
+	l.verifiers = append(l.verifiers, verifier)
+}
+
+func (l *Loader) RegisterDecompressor(decompressor Decompressor) {
+	exts := decompressor.Extensions()
+	for _, ext := range exts {
+		if l.decompressors[ext] != nil {
+			panic(fmt.Sprintf("decompressor with extension %s already registered", ext))
+		}
+		l.decompressors[ext] = decompressor
+	}
+}
+
+// RegisterDecrypter adds a decrypter that every config payload is passed
+// through after it has been verified.
+func (l *Loader) RegisterDecrypter(decrypter Decrypter) {
+	l.decrypters = append(l.decrypters, decrypter)
+}
+
 var defaultLoader = NewLoader()
 
+var watchRetryInterval = 5 * time.Second
+
 func LoadURL(url string, v interface{}) error {
 	return defaultLoader.LoadURL(url, v)
 }
 
+func LoadURLs(v interface{}, urls ...string) error {
+	return defaultLoader.LoadURLs(v, urls...)
+}
+
+func LoadURLFirst(v interface{}, urls ...string) error {
+	return defaultLoader.LoadURLFirst(v, urls...)
+}
+
+func WatchURL(ctx context.Context, url string, v interface{}, fn func(v interface{}, err error)) error {
+	return defaultLoader.WatchURL(ctx, url, v, fn)
+}
+
 func LoadJSON(r io.ReadCloser, v interface{}) error {
 	return defaultLoader.LoadJSON(r, v)
 }
@@ -159,6 +492,22 @@ func RegisterSource(source Source) {
 	defaultLoader.RegisterSource(source)
 }
 
+func ReplaceSource(source Source) {
+	defaultLoader.ReplaceSource(source)
+}
+
 func RegisterUnmarshaller(unmarshaller Unmarshaller) {
 	defaultLoader.RegisterUnmarshaller(unmarshaller)
 }
+
+func RegisterVerifier(verifier Verifier) {
+	defaultLoader.RegisterVerifier(verifier)
+}
+
+func RegisterDecrypter(decrypter Decrypter) {
+	defaultLoader.RegisterDecrypter(decrypter)
+}
+
+func RegisterDecompressor(decompressor Decompressor) {
+	defaultLoader.RegisterDecompressor(decompressor)
+}
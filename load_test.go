@@ -22,7 +22,7 @@ type testConfig struct {
 	DefaultString         string `config:"default=whatever"`
 	RequiredString        string `config:"required"`
 	DefaultRequiredString string `config:"default=whatever"`
-	RequiredRenamedString string `json:"required_renamed_string" toml:"required_renamed_string" yaml:"required_renamed_string" config:"required"`
+	RequiredRenamedString string `json:"required_renamed_string" toml:"required_renamed_string" yaml:"required_renamed_string" hcl:"required_renamed_string" ini:"required_renamed_string" properties:"required_renamed_string" config:"required"`
 	Nested                nestedConfig
 	NestedPtr             *nestedConfig
 	ArrayOfNums           []int
@@ -52,6 +52,30 @@ func TestLoad_ValidConfig_TOML(t *testing.T) {
 	testValidConfig(t, abs)
 }
 
+func TestLoad_ValidConfig_HCL(t *testing.T) {
+	abs, err := filepath.Abs("testdata/valid_config.hcl")
+	require.NoError(t, err)
+	testValidConfig(t, abs)
+}
+
+func TestLoad_ValidConfig_INI(t *testing.T) {
+	abs, err := filepath.Abs("testdata/valid_config.ini")
+	require.NoError(t, err)
+	testValidConfig(t, abs)
+}
+
+func TestLoad_ValidConfig_Properties(t *testing.T) {
+	abs, err := filepath.Abs("testdata/valid_config.properties")
+	require.NoError(t, err)
+	testValidConfig(t, abs)
+}
+
+func TestLoad_ValidConfig_JSON5(t *testing.T) {
+	abs, err := filepath.Abs("testdata/valid_config.json5")
+	require.NoError(t, err)
+	testValidConfig(t, abs)
+}
+
 func TestLoad_DefaultValues(t *testing.T) {
 	type cfg struct {
 		Bool    bool    `config:"default=true"`
@@ -228,3 +252,64 @@ func testValidConfig(t *testing.T, abs string) {
 	}
 	require.EqualValues(t, expCfg, actCfg)
 }
+
+func TestLoadURLFirst(t *testing.T) {
+	type cfg struct {
+		Name string `config:"required"`
+		Port int
+	}
+
+	DefaultMemorySource.Set("first_invalid.json", []byte(`{"Port": 1}`))
+	DefaultMemorySource.Set("first_valid.json", []byte(`{"Name": "valid", "Port": 2}`))
+	DefaultMemorySource.Set("first_also_valid.json", []byte(`{"Name": "also valid", "Port": 3}`))
+	defer DefaultMemorySource.Delete("first_invalid.json")
+	defer DefaultMemorySource.Delete("first_valid.json")
+	defer DefaultMemorySource.Delete("first_also_valid.json")
+
+	actCfg := &cfg{Name: "untouched"}
+	require.NoError(t, LoadURLFirst(actCfg, "mem://first_missing.json", "mem://first_invalid.json", "mem://first_valid.json", "mem://first_also_valid.json"))
+	require.Equal(t, &cfg{Name: "valid", Port: 2}, actCfg)
+
+	actCfg = &cfg{Name: "untouched"}
+	err := LoadURLFirst(actCfg, "mem://first_missing.json", "mem://first_invalid.json")
+	require.Error(t, err)
+	require.Equal(t, &cfg{Name: "untouched"}, actCfg)
+	urlErrs, ok := err.(URLErrors)
+	require.True(t, ok)
+	require.Len(t, urlErrs, 2)
+	require.Equal(t, "mem://first_missing.json", urlErrs[0].URL)
+	require.Contains(t, urlErrs[0].Error(), "no config registered under first_missing.json")
+	require.Equal(t, "mem://first_invalid.json", urlErrs[1].URL)
+	require.Contains(t, urlErrs[1].Error(), "required field Name not found")
+	require.Contains(t, err.Error(), "all 2 config URLs failed")
+
+	require.Error(t, LoadURLFirst(new(cfg)))
+}
+
+func TestLoadURLs(t *testing.T) {
+	type cfg struct {
+		Name   string `config:"required"`
+		ID     int64
+		Labels map[string]string
+		Limits map[string]interface{}
+		Hosts  []struct {
+			Addr string `config:"required"`
+			Port int    `config:"default=80"`
+		}
+	}
+
+	DefaultMemorySource.Set("layers_base.yaml", []byte("name: base\nlabels:\n  App: web\nlimits:\n  Memory: 1\nhosts:\n  - addr: a\n"))
+	DefaultMemorySource.Set("layers_override.json", []byte(`{"ID": 9007199254740993, "Labels": {"Tier": "front"}, "Limits": {"MaxBytes": 9007199254740993}}`))
+	defer DefaultMemorySource.Delete("layers_base.yaml")
+	defer DefaultMemorySource.Delete("layers_override.json")
+
+	actCfg := new(cfg)
+	require.NoError(t, LoadURLs(actCfg, "mem://layers_base.yaml", "mem://layers_override.json"))
+	require.Equal(t, "base", actCfg.Name)
+	require.Equal(t, int64(9007199254740993), actCfg.ID)
+	require.Equal(t, map[string]string{"App": "web", "Tier": "front"}, actCfg.Labels)
+	require.Equal(t, map[string]interface{}{"Memory": 1, "MaxBytes": int64(9007199254740993)}, actCfg.Limits)
+	require.Len(t, actCfg.Hosts, 1)
+	require.Equal(t, "a", actCfg.Hosts[0].Addr)
+	require.Equal(t, 80, actCfg.Hosts[0].Port)
+}
@@ -0,0 +1,235 @@
+package configurer
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+const PROPERTIES = "properties"
+
+// PropertiesUnmarshaller decodes Java .properties files. Dotted keys nest, so
+// server.port populates the Port field of the Server struct, and indexed
+// keys such as hosts[0] or servers[1].name populate slices.
+//
+// The format follows java.util.Properties: keys are separated from values by
+// =, : or whitespace, lines starting with # or ! are comments, a trailing
+// backslash continues a value onto the next line, and \uXXXX escapes are
+// decoded. Errors report the line they were found on.
+type PropertiesUnmarshaller struct {
+}
+
+var DefaultPropertiesUnmarshaller = new(PropertiesUnmarshaller)
+
+func (p *PropertiesUnmarshaller) Extensions() []string {
+	return []string{PROPERTIES}
+}
+
+func (p *PropertiesUnmarshaller) ExtractFieldName(field reflect.StructField) string {
+	tag := field.Tag.Get("properties")
+	if tag == "" {
+		return field.Name
+	}
+	tagFields := strings.Split(tag, ",")
+	if tagFields[0] == "" {
+		return field.Name
+	}
+	return tagFields[0]
+}
+
+func (p *PropertiesUnmarshaller) Unmarshal(data []byte, v interface{}) error {
+	keyMap, err := p.parse(string(data))
+	if err != nil {
+		return err
+	}
+	if mapPtr, ok := v.(*map[string]interface{}); ok {
+		*mapPtr = keyMap
+		return nil
+	}
+	return decodeKeyMap(keyMap, v, p.ExtractFieldName)
+}
+
+func (p *PropertiesUnmarshaller) parse(data string) (map[string]interface{}, error) {
+	keyMap := make(map[string]interface{})
+	data = strings.TrimPrefix(data, "\ufeff")
+	data = strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(data)
+	lines := strings.Split(data, "\n")
+	for idx := 0; idx < len(lines); idx++ {
+		lineNum := idx + 1
+		line := strings.TrimLeft(lines[idx], " \t\f")
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+		// A line ending in an odd number of backslashes continues onto the
+		// next one, whose leading whitespace is dropped.
+		for p.continues(line) && idx+1 < len(lines) {
+			idx++
+			line = line[:len(line)-1] + strings.TrimLeft(lines[idx], " \t\f")
+		}
+		if p.continues(line) {
+			line = line[:len(line)-1]
+		}
+
+		rawKey, rawValue := p.split(line)
+		key, err := p.unescape(rawKey)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+		value, err := p.unescape(rawValue)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+		path, err := p.keyPath(key)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+		if err := p.set(keyMap, path, value); err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+	}
+	return keyMap, nil
+}
+
+func (p *PropertiesUnmarshaller) continues(line string) bool {
+	backslashes := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		backslashes++
+	}
+	return backslashes%2 == 1
+}
+
+// split separates a logical line into its raw key and value. The key ends at
+// the first unescaped =, : or whitespace, and the separator may be
+// surrounded by whitespace.
+func (p *PropertiesUnmarshaller) split(line string) (string, string) {
+	keyEnd := len(line)
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.IndexByte("=: \t\f", line[i]) != -1 {
+			keyEnd = i
+			break
+		}
+	}
+	rest := strings.TrimLeft(line[keyEnd:], " \t\f")
+	if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+		rest = strings.TrimLeft(rest[1:], " \t\f")
+	}
+	return line[:keyEnd], rest
+}
+
+func (p *PropertiesUnmarshaller) unescape(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			if i+5 > len(s) {
+				return "", fmt.Errorf("malformed \\uxxxx escape \\%s", s[i:])
+			}
+			code, err := strconv.ParseUint(s[i+1:i+5], 16, 16)
+			if err != nil {
+				return "", fmt.Errorf("malformed \\uxxxx escape \\%s", s[i:i+5])
+			}
+			i += 4
+			r := rune(code)
+			// Characters outside the BMP are escaped as UTF-16 surrogate
+			// pairs, e.g. \uD83D\uDE00.
+			if utf16.IsSurrogate(r) && i+7 <= len(s) && s[i+1] == '\\' && s[i+2] == 'u' {
+				if low, err := strconv.ParseUint(s[i+3:i+7], 16, 16); err == nil {
+					if pair := utf16.DecodeRune(r, rune(low)); pair != unicode.ReplacementChar {
+						r = pair
+						i += 6
+					}
+				}
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// keyPath splits a key like servers[1].name into the nested keys servers, 1
+// and name.
+func (p *PropertiesUnmarshaller) keyPath(key string) ([]string, error) {
+	if key == "" {
+		return nil, fmt.Errorf("key is empty")
+	}
+	var path []string
+	for _, part := range strings.Split(key, ".") {
+		name := part
+		var indices []string
+		if bracketIdx := strings.Index(part, "["); bracketIdx != -1 {
+			name = part[:bracketIdx]
+			rest := part[bracketIdx:]
+			for rest != "" {
+				closeIdx := strings.Index(rest, "]")
+				if rest[0] != '[' || closeIdx == -1 {
+					return nil, fmt.Errorf("malformed index in key %s", key)
+				}
+				index := rest[1:closeIdx]
+				if n, err := strconv.Atoi(index); err != nil || n < 0 {
+					return nil, fmt.Errorf("invalid index %s in key %s", index, key)
+				}
+				indices = append(indices, index)
+				rest = rest[closeIdx+1:]
+			}
+		}
+		if name == "" {
+			return nil, fmt.Errorf("empty segment in key %s", key)
+		}
+		path = append(path, name)
+		path = append(path, indices...)
+	}
+	return path, nil
+}
+
+// set stores value under path, refusing to replace a nested key with a
+// value or vice versa.
+func (p *PropertiesUnmarshaller) set(keyMap map[string]interface{}, path []string, value string) error {
+	// Keys differing only in case populate the same field, so they're
+	// matched the same way here.
+	m := keyMap
+	for i, key := range path[:len(path)-1] {
+		_, existing, _ := lookupKeyMap(m, key)
+		switch next := existing.(type) {
+		case nil:
+			created := make(map[string]interface{})
+			m[key] = created
+			m = created
+		case map[string]interface{}:
+			m = next
+		default:
+			return fmt.Errorf("key %s is already set to a value", strings.Join(path[:i+1], "."))
+		}
+	}
+	last := path[len(path)-1]
+	existingKey, existing, ok := lookupKeyMap(m, last)
+	if _, isMap := existing.(map[string]interface{}); isMap {
+		return fmt.Errorf("key %s already has nested keys", strings.Join(path, "."))
+	}
+	if ok {
+		delete(m, existingKey)
+	}
+	m[last] = value
+	return nil
+}
@@ -0,0 +1,89 @@
+package configurer
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestPropertiesUnmarshaller(t *testing.T) {
+	type cfg struct {
+		Name   string `properties:"service_name" config:"required"`
+		Server struct {
+			Port    int `config:"default=8080"`
+			Address string
+		}
+		Greeting string
+		Path     string
+		Hosts    []string
+		Backends []struct {
+			Host string `config:"required"`
+			Port int
+		}
+		Labels map[string]string
+	}
+
+	actCfg := new(cfg)
+	require.NoError(t, DefaultPropertiesUnmarshaller.Unmarshal([]byte(`# application.properties
+! also a comment
+service_name=app
+server.address   0.0.0.0
+greeting : caf\u00e9 says \
+           hello\tthere
+path = C:\\configs\\app
+hosts[0]=a.internal
+hosts[1]=b.internal
+backends[0].host=api.internal
+backends[0].port=9000
+backends[1].host=auth.internal
+labels.Team=payments
+Server.Port=9090
+weird\ key\=name = value
+`), actCfg))
+	require.Equal(t, "app", actCfg.Name)
+	require.Equal(t, "0.0.0.0", actCfg.Server.Address)
+	require.Equal(t, 9090, actCfg.Server.Port)
+	require.Equal(t, map[string]string{"Team": "payments"}, actCfg.Labels)
+	require.Equal(t, "café says hello\tthere", actCfg.Greeting)
+	require.Equal(t, `C:\configs\app`, actCfg.Path)
+	require.Equal(t, []string{"a.internal", "b.internal"}, actCfg.Hosts)
+	require.Len(t, actCfg.Backends, 2)
+	require.Equal(t, 9000, actCfg.Backends[0].Port)
+	require.Equal(t, "auth.internal", actCfg.Backends[1].Host)
+
+	keyMap := make(map[string]interface{})
+	require.NoError(t, DefaultPropertiesUnmarshaller.Unmarshal([]byte(`weird\ key\=name = value`), &keyMap))
+	require.Equal(t, map[string]interface{}{"weird key=name": "value"}, keyMap)
+
+	keyMap = make(map[string]interface{})
+	require.NoError(t, DefaultPropertiesUnmarshaller.Unmarshal([]byte(`a=\uD83D\uDE00 \uD83D!`), &keyMap))
+	require.Equal(t, map[string]interface{}{"a": "\U0001F600 \uFFFD!"}, keyMap)
+
+	loader := NewLoader()
+	loader.RegisterSource(DefaultMemorySource)
+	loader.RegisterUnmarshaller(DefaultPropertiesUnmarshaller)
+	DefaultMemorySource.Set("application.properties", []byte("service_name=app\nbackends[0].port=1\n"))
+	defer DefaultMemorySource.Delete("application.properties")
+	err := loader.LoadURL("mem://application.properties", new(cfg))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "required field Host not found")
+
+	DefaultMemorySource.Set("application.properties", []byte("service_name=app\n"))
+	actCfg = new(cfg)
+	require.NoError(t, loader.LoadURL("mem://application.properties", actCfg))
+	require.Equal(t, 8080, actCfg.Server.Port)
+
+	for input, msg := range map[string]string{
+		"a=1\ngreeting=caf\\u00g9\n": "line 2: malformed \\uxxxx escape \\u00g9",
+		"a=1\n\ngreeting=caf\\u00\n": "line 3: malformed \\uxxxx escape \\u00",
+		"hosts[x]=a\n":               "line 1: invalid index x in key hosts[x]",
+		"hosts[0=a\n":                "line 1: malformed index in key hosts[0",
+		"server..port=1\n":           "line 1: empty segment in key server..port",
+		"server=a\nserver.port=1\n":  "line 2: key server is already set to a value",
+		"server.port=1\nserver=a\n":  "line 2: key server already has nested keys",
+		"a=1\\\n  b\n=value\n":       "line 3: key is empty",
+	} {
+		err := DefaultPropertiesUnmarshaller.Unmarshal([]byte(input), new(map[string]interface{}))
+		require.Error(t, err, input)
+		require.Contains(t, err.Error(), msg)
+	}
+}
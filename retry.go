@@ -0,0 +1,142 @@
+package configurer
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+)
+
+// RetrySource wraps another source and retries failed reads with exponential
+// backoff and jitter. It's useful when a service may boot before its config
+// server is reachable:
+//
+//	configurer.ReplaceSource(&configurer.RetrySource{
+//		Source:     new(configurer.HTTPSource),
+//		MaxElapsed: time.Minute,
+//	})
+type RetrySource struct {
+	Source Source
+	// MaxAttempts limits the number of reads, including the first one.
+	// Defaults to 5.
+	MaxAttempts int
+	// MaxElapsed limits the total time spent retrying. Zero means no limit.
+	MaxElapsed time.Duration
+	// InitialInterval is the delay before the first retry. It doubles after
+	// every attempt up to MaxInterval. Defaults to 100 milliseconds and 10
+	// seconds respectively.
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	// Retryable reports whether a read that failed with err should be
+	// retried. Defaults to IsTransient.
+	Retryable func(err error) bool
+}
+
+func (r *RetrySource) Protocols() []string {
+	return r.Source.Protocols()
+}
+
+func (r *RetrySource) Format(url string) Unmarshaller {
+	if formatSource, ok := r.Source.(FormatSource); ok {
+		return formatSource.Format(url)
+	}
+	return nil
+}
+
+func (r *RetrySource) Synthetic(url string) bool {
+	if syntheticSource, ok := r.Source.(SyntheticSource); ok {
+		return syntheticSource.Synthetic(url)
+	}
+	return false
+}
+
+func (r *RetrySource) verifiedBy(l *Loader) bool {
+	if partVerifier, ok := r.Source.(partVerifier); ok {
+		return partVerifier.verifiedBy(l)
+	}
+	return false
+}
+
+func (r *RetrySource) Watch(ctx context.Context, url string) error {
+	if watcher, ok := r.Source.(Watcher); ok {
+		return watcher.Watch(ctx, url)
+	}
+	return errWatchUnsupported
+}
+
+func (r *RetrySource) commit(url string, sidecars []string) {
+	if inner, ok := r.Source.(committer); ok {
+		inner.commit(url, sidecars)
+	}
+}
+
+func (r *RetrySource) Reader(url string) (io.ReadCloser, error) {
+	maxAttempts := r.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = 5
+	}
+	interval := r.InitialInterval
+	if interval == 0 {
+		interval = 100 * time.Millisecond
+	}
+	maxInterval := r.MaxInterval
+	if maxInterval == 0 {
+		maxInterval = 10 * time.Second
+	}
+	retryable := r.Retryable
+	if retryable == nil {
+		retryable = IsTransient
+	}
+
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		rd, err := r.Source.Reader(url)
+		if err == nil {
+			return rd, nil
+		}
+		if !retryable(err) {
+			return nil, err
+		}
+		if attempt >= maxAttempts {
+			return nil, errors.Wrap(err, fmt.Sprintf("giving up after %d attempts", attempt))
+		}
+
+		// Equal jitter: wait at least half the interval so that retries
+		// still back off, but spread them out across clients.
+		delay := interval/2 + time.Duration(rand.Int63n(int64(interval/2)+1))
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > delay {
+			delay = statusErr.RetryAfter
+		}
+		if r.MaxElapsed > 0 && time.Since(start)+delay > r.MaxElapsed {
+			return nil, errors.Wrap(err, fmt.Sprintf("giving up after %d attempts in %s", attempt, time.Since(start).Round(time.Millisecond)))
+		}
+		time.Sleep(delay)
+
+		interval *= 2
+		if interval > maxInterval {
+			interval = maxInterval
+		}
+	}
+}
+
+// IsTransient reports whether err is likely to go away on its own: a 5xx or
+// 429 response, a refused or reset connection, or a timeout.
+func IsTransient(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == 429
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package configurer
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetrySource(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/flaky":
+			if atomic.AddInt32(&attempts, 1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprint(w, "testing")
+		case "/throttled":
+			atomic.AddInt32(&attempts, 1)
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			atomic.AddInt32(&attempts, 1)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	source := &RetrySource{
+		Source:          new(HTTPSource),
+		InitialInterval: time.Millisecond,
+	}
+	require.EqualValues(t, []string{"http", "https"}, source.Protocols())
+
+	rd, err := source.Reader(ts.URL + "/flaky")
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(rd)
+	require.NoError(t, err)
+	require.Equal(t, "testing", string(data))
+	require.EqualValues(t, 3, atomic.LoadInt32(&attempts))
+
+	atomic.StoreInt32(&attempts, 0)
+	_, err = source.Reader(ts.URL + "/missing")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "expected 200 response code but got 404")
+	require.EqualValues(t, 1, atomic.LoadInt32(&attempts))
+
+	atomic.StoreInt32(&attempts, 0)
+	_, err = source.Reader(ts.URL + "/throttled")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "giving up after 5 attempts")
+	require.EqualValues(t, 5, atomic.LoadInt32(&attempts))
+
+	atomic.StoreInt32(&attempts, 0)
+	source.InitialInterval = 50 * time.Millisecond
+	source.MaxAttempts = 100
+	source.MaxElapsed = 120 * time.Millisecond
+	_, err = source.Reader(ts.URL + "/throttled")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "giving up after")
+	require.Less(t, atomic.LoadInt32(&attempts), int32(5))
+}
+
+func TestRetrySource_ConnectionRefused(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	url := ts.URL
+	ts.Close()
+
+	source := &RetrySource{
+		Source:          new(HTTPSource),
+		MaxAttempts:     3,
+		InitialInterval: time.Millisecond,
+	}
+	_, err := source.Reader(url)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "giving up after 3 attempts")
+	require.True(t, IsTransient(err))
+}
+
+func TestIsTransient(t *testing.T) {
+	require.True(t, IsTransient(&StatusError{StatusCode: 500}))
+	require.True(t, IsTransient(&StatusError{StatusCode: 503}))
+	require.True(t, IsTransient(&StatusError{StatusCode: 429}))
+	require.False(t, IsTransient(&StatusError{StatusCode: 404}))
+	require.False(t, IsTransient(&StatusError{StatusCode: 401}))
+	require.False(t, IsTransient(fmt.Errorf("some other error")))
+}
@@ -0,0 +1,303 @@
+package configurer
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// emptyPayloadHash is the SHA-256 of an empty request body.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3Source reads configs from S3-compatible object storage, e.g.
+// s3://my-bucket/app/config.yaml. A specific object version can be read by
+// adding a versionId query parameter, e.g.
+// s3://my-bucket/app/config.yaml?versionId=3HL4kqtJlcpXroDTDmJ.
+//
+// Requests are signed with AWS Signature Version 4, using credentials from
+// the standard AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+// environment variables unless they're set on the source. Requests are sent
+// unsigned if there are no credentials, which works for public buckets.
+//
+// Watch polls the object's ETag for changes.
+type S3Source struct {
+	// Endpoint is the base URL of an S3-compatible service, e.g.
+	// http://127.0.0.1:9000 for MinIO. Objects are addressed path-style
+	// below it. Defaults to AWS, using virtual-hosted-style addressing.
+	Endpoint string
+	// Region is used to sign requests. Defaults to the AWS_REGION or
+	// AWS_DEFAULT_REGION environment variables, then us-east-1.
+	Region string
+	// AccessKeyID, SecretAccessKey and SessionToken override the
+	// credentials from the environment.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Client is used to make requests. Defaults to http.DefaultClient.
+	Client *http.Client
+	// PollInterval is how often Watch checks the object's ETag. Defaults to
+	// one minute.
+	PollInterval time.Duration
+
+	mtx   sync.Mutex
+	etags map[string]string
+}
+
+func (s *S3Source) Protocols() []string {
+	return []string{"s3"}
+}
+
+func (s *S3Source) Reader(url string) (io.ReadCloser, error) {
+	res, err := s.do(context.Background(), http.MethodGet, url)
+	if err != nil {
+		return nil, err
+	}
+	s.mtx.Lock()
+	if s.etags == nil {
+		s.etags = make(map[string]string)
+	}
+	s.etags[url] = res.Header.Get("ETag")
+	s.mtx.Unlock()
+	return res.Body, nil
+}
+
+func (s *S3Source) Watch(ctx context.Context, url string) error {
+	if _, _, version := s.location(url); version != "" {
+		// A specific version of an object never changes.
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	s.mtx.Lock()
+	last, ok := s.etags[url]
+	s.mtx.Unlock()
+	if !ok {
+		res, err := s.do(ctx, http.MethodHead, url)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		last = res.Header.Get("ETag")
+	}
+
+	interval := s.PollInterval
+	if interval == 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		res, err := s.do(ctx, http.MethodHead, url)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		if res.Header.Get("ETag") != last {
+			return nil
+		}
+	}
+}
+
+func (s *S3Source) do(ctx context.Context, method string, url string) (*http.Response, error) {
+	bucket, key, version := s.location(url)
+	if bucket == "" || key == "" {
+		return nil, fmt.Errorf("expected s3://bucket/key but got %s", url)
+	}
+	region := s.region()
+
+	var reqURL string
+	if s.Endpoint != "" {
+		reqURL = fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(s.Endpoint, "/"), awsURIEncode(bucket, true), awsURIEncode(key, false))
+	} else {
+		reqURL = fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, region, awsURIEncode(key, false))
+	}
+	if version != "" {
+		reqURL += "?versionId=" + awsURIEncode(version, true)
+	}
+	req, err := http.NewRequest(method, reqURL, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating request")
+	}
+	req = req.WithContext(ctx)
+
+	accessKeyID, secretAccessKey, sessionToken := s.credentials()
+	if accessKeyID != "" {
+		req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+		signV4(req, emptyPayloadHash, accessKeyID, secretAccessKey, sessionToken, region, "s3", time.Now())
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error querying S3")
+	}
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, fmt.Errorf("object %s not found in bucket %s", key, bucket)
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, &StatusError{
+			StatusCode: res.StatusCode,
+		}
+	}
+	return res, nil
+}
+
+func (s *S3Source) location(url string) (string, string, string) {
+	location := strings.TrimPrefix(url, "s3://")
+	var version string
+	if queryIdx := strings.Index(location, "?"); queryIdx != -1 {
+		query, _ := neturl.ParseQuery(location[queryIdx+1:])
+		version = query.Get("versionId")
+		location = location[:queryIdx]
+	}
+	slashIdx := strings.Index(location, "/")
+	if slashIdx == -1 {
+		return location, "", version
+	}
+	return location[:slashIdx], location[slashIdx+1:], version
+}
+
+func (s *S3Source) region() string {
+	if s.Region != "" {
+		return s.Region
+	}
+	for _, name := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if region := os.Getenv(name); region != "" {
+			return region
+		}
+	}
+	return "us-east-1"
+}
+
+func (s *S3Source) credentials() (string, string, string) {
+	if s.AccessKeyID != "" {
+		return s.AccessKeyID, s.SecretAccessKey, s.SessionToken
+	}
+	return os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN")
+}
+
+// signV4 signs req with AWS Signature Version 4. Every header already set on
+// req is signed, along with the host and the x-amz-* headers added here.
+// payloadHash is the hex SHA-256 of the request body; S3 also expects it in
+// the X-Amz-Content-Sha256 header.
+func signV4(req *http.Request, payloadHash string, accessKeyID string, secretAccessKey string, sessionToken string, region string, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+
+	headers := map[string]string{
+		"host": req.URL.Host,
+	}
+	for name, vals := range req.Header {
+		trimmed := make([]string, len(vals))
+		for i, val := range vals {
+			trimmed[i] = strings.Join(strings.Fields(val), " ")
+		}
+		headers[strings.ToLower(name)] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	query := req.URL.Query()
+	queryKeys := make([]string, 0, len(query))
+	for k := range query {
+		queryKeys = append(queryKeys, k)
+	}
+	sort.Strings(queryKeys)
+	var queryParts []string
+	for _, k := range queryKeys {
+		vals := append([]string(nil), query[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			queryParts = append(queryParts, awsURIEncode(k, true)+"="+awsURIEncode(v, true))
+		}
+	}
+
+	canonicalURI := req.URL.EscapedPath()
+	if canonicalURI == "" {
+		canonicalURI = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI,
+		strings.Join(queryParts, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, region, service)
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(canonicalHash[:]),
+	}, "\n")
+
+	key := []byte("AWS4" + secretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsURIEncode percent-encodes everything but unreserved characters, as
+// SigV4 requires. Slashes are left alone unless encodeSlash is set.
+func awsURIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '.', c == '_', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
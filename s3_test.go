@@ -0,0 +1,136 @@
+package configurer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeS3 struct {
+	mtx      sync.Mutex
+	objects  map[string]string
+	versions map[string]string
+	etag     int
+}
+
+func (f *fakeS3) put(path string, body string) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.objects[path] = body
+	f.etag++
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Re-sign the request as received to check that the path, query and
+	// headers the client signed survived the trip.
+	auth := r.Header.Get("Authorization")
+	signedAt, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil || !strings.Contains(auth, "Credential=AKID/"+signedAt.Format("20060102")+"/eu-west-1/s3/aws4_request") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	check, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	check.Header.Set("X-Amz-Content-Sha256", r.Header.Get("X-Amz-Content-Sha256"))
+	signV4(check, r.Header.Get("X-Amz-Content-Sha256"), "AKID", "SECRET", r.Header.Get("X-Amz-Security-Token"), "eu-west-1", "s3", signedAt)
+	if check.Header.Get("Authorization") != auth {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	body, ok := f.objects[r.URL.Path]
+	if version := r.URL.Query().Get("versionId"); version != "" {
+		body, ok = f.versions[r.URL.Path+"@"+version]
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("ETag", fmt.Sprintf(`"%d"`, f.etag))
+	if r.Method == http.MethodGet {
+		w.Write([]byte(body))
+	}
+}
+
+func TestS3Source(t *testing.T) {
+	var gzipped bytes.Buffer
+	gw := gzip.NewWriter(&gzipped)
+	gw.Write([]byte("name: compressed\n"))
+	require.NoError(t, gw.Close())
+
+	s3 := &fakeS3{
+		objects: make(map[string]string),
+		versions: map[string]string{
+			"/configs/app/config.yaml@v1":    "name: old\n",
+			"/configs/app/config.yaml.gz@v1": gzipped.String(),
+		},
+	}
+	s3.put("/configs/app/config.yaml", "name: app\n")
+	s3.put("/configs/app/my config.yaml", "name: spaced\n")
+	ts := httptest.NewServer(s3)
+	defer ts.Close()
+
+	source := &S3Source{
+		Endpoint:        ts.URL,
+		Region:          "eu-west-1",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		SessionToken:    "session",
+		PollInterval:    10 * time.Millisecond,
+	}
+	loader := NewLoader()
+	loader.RegisterSource(source)
+	loader.RegisterUnmarshaller(DefaultYAMLUnmarshaller)
+	loader.RegisterDecompressor(DefaultGzipDecompressor)
+
+	type cfg struct {
+		Name string
+	}
+	actCfg := new(cfg)
+	require.NoError(t, loader.LoadURL("s3://configs/app/config.yaml", actCfg))
+	require.Equal(t, "app", actCfg.Name)
+	require.NoError(t, loader.LoadURL("s3://configs/app/my config.yaml", actCfg))
+	require.Equal(t, "spaced", actCfg.Name)
+	require.NoError(t, loader.LoadURL("s3://configs/app/config.yaml?versionId=v1", actCfg))
+	require.Equal(t, "old", actCfg.Name)
+	require.NoError(t, loader.LoadURL("s3://configs/app/config.yaml.gz?versionId=v1", actCfg))
+	require.Equal(t, "compressed", actCfg.Name)
+
+	err := loader.LoadURL("s3://configs/app/missing.yaml", actCfg)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "object app/missing.yaml not found in bucket configs")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- source.Watch(ctx, "s3://configs/app/config.yaml")
+	}()
+	time.Sleep(50 * time.Millisecond)
+	s3.put("/configs/app/config.yaml", "name: updated\n")
+	require.NoError(t, <-done)
+
+	source.SecretAccessKey = "wrong"
+	err = loader.LoadURL("s3://configs/app/config.yaml", actCfg)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "expected 200 response code but got 403")
+}
+
+func TestSignV4(t *testing.T) {
+	// The get-vanilla case from the AWS Signature Version 4 test suite.
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	require.NoError(t, err)
+	signV4(req, emptyPayloadHash, "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "", "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+	require.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, "+
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31", req.Header.Get("Authorization"))
+}
@@ -1,12 +1,22 @@
 package configurer
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"github.com/pkg/errors"
 	"io"
+	"io/fs"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 type Source interface {
@@ -14,6 +24,46 @@ type Source interface {
 	Reader(url string) (io.ReadCloser, error)
 }
 
+// FormatSource is implemented by sources whose payload format isn't given by
+// the URL's file extension. Returning nil falls back to extension detection.
+type FormatSource interface {
+	Source
+	Format(url string) Unmarshaller
+}
+
+// Watcher is implemented by sources that can tell when the config behind a
+// URL has changed. See Loader.WatchURL.
+type Watcher interface {
+	Source
+	// Watch blocks until the config behind url differs from the one last
+	// returned by Reader, or until ctx is done.
+	Watch(ctx context.Context, url string) error
+}
+
+// SyntheticSource is implemented by sources whose payload isn't a document
+// read as is, but is assembled from something else, such as environment
+// variables or the keys below a Consul prefix. There's no sidecar file or
+// digest to check such payloads against, so registered verifiers see them
+// like payloads loaded from a reader, with no URL, and verifiers that require
+// a digest or signature reject them. URLs with a digest fragment are
+// rejected outright.
+type SyntheticSource interface {
+	Source
+	Synthetic(url string) bool
+}
+
+// partVerifier is implemented by synthetic sources that verify each document
+// their payload is assembled from, like DirSource. verifiedBy reports whether
+// those documents were checked by l's verifiers, in which case the assembled
+// payload needs no further verification.
+type partVerifier interface {
+	verifiedBy(l *Loader) bool
+}
+
+// errWatchUnsupported is returned by watchers that can't watch a particular
+// URL, such as source wrappers whose underlying source isn't a Watcher.
+var errWatchUnsupported = errors.New("source does not support watching")
+
 type FileSource struct {
 }
 
@@ -26,7 +76,42 @@ func (f *FileSource) Reader(url string) (io.ReadCloser, error) {
 	return os.OpenFile(path, os.O_RDONLY, 0)
 }
 
+// HTTPSource fetches configs over HTTP(S). The zero value uses
+// http.DefaultClient; the fields below add authentication, TLS settings and
+// timeouts. Fields should not be modified after the first request.
 type HTTPSource struct {
+	// Client is used to make requests. If set, CAFile, CertFile and KeyFile
+	// are ignored and TLS must be configured on the client itself.
+	Client *http.Client
+	// Header is added to every request.
+	Header http.Header
+	// HeaderFunc is called before every request to add dynamic headers,
+	// such as short-lived credentials.
+	HeaderFunc func(url string) (http.Header, error)
+	// Username and Password enable basic auth.
+	Username string
+	Password string
+	// BearerToken is sent in the Authorization header. If it's empty, the
+	// token is read from the environment variable named by BearerTokenEnv or
+	// the file at BearerTokenFile, in that order, on every request so that
+	// rotated tokens are picked up.
+	BearerToken     string
+	BearerTokenEnv  string
+	BearerTokenFile string
+	// CAFile is a PEM bundle of CAs to trust in addition to the system
+	// roots.
+	CAFile string
+	// CertFile and KeyFile are a PEM client certificate and key for mutual
+	// TLS.
+	CertFile string
+	KeyFile  string
+	// Timeout bounds each request, including reading the response body.
+	// Zero means no timeout.
+	Timeout time.Duration
+
+	clientOnce sync.Once
+	client     *http.Client
+	clientErr  error
 }
 
 func (h *HTTPSource) Protocols() []string {
@@ -34,17 +119,433 @@ func (h *HTTPSource) Protocols() []string {
 }
 
 func (h *HTTPSource) Reader(url string) (io.ReadCloser, error) {
-	res, err := http.Get(url)
+	client, err := h.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating request")
+	}
+	if err := h.decorate(req); err != nil {
+		return nil, err
+	}
+
+	res, err := client.Do(req)
 	if err != nil {
 		return nil, errors.Wrap(err, "error getting URL")
 	}
 	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("expected 200 response code but got %d", res.StatusCode)
+		res.Body.Close()
+		statusErr := &StatusError{
+			StatusCode: res.StatusCode,
+		}
+		if secs, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil {
+			statusErr.RetryAfter = time.Duration(secs) * time.Second
+		}
+		return nil, statusErr
 	}
 	return res.Body, nil
 }
 
+// StatusError is returned by HTTPSource when the server responds with
+// anything other than a 200.
+type StatusError struct {
+	StatusCode int
+	// RetryAfter is parsed from the Retry-After header, if the server sent
+	// one in seconds.
+	RetryAfter time.Duration
+}
+
+func (s *StatusError) Error() string {
+	return fmt.Sprintf("expected 200 response code but got %d", s.StatusCode)
+}
+
+func (h *HTTPSource) decorate(req *http.Request) error {
+	for k, vals := range h.Header {
+		for _, v := range vals {
+			req.Header.Add(k, v)
+		}
+	}
+	if h.HeaderFunc != nil {
+		header, err := h.HeaderFunc(req.URL.String())
+		if err != nil {
+			return errors.Wrap(err, "error getting request headers")
+		}
+		for k, vals := range header {
+			for _, v := range vals {
+				req.Header.Add(k, v)
+			}
+		}
+	}
+
+	if h.Username != "" || h.Password != "" {
+		req.SetBasicAuth(h.Username, h.Password)
+	}
+	token, err := h.bearerToken()
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return nil
+}
+
+func (h *HTTPSource) bearerToken() (string, error) {
+	if h.BearerToken != "" {
+		return h.BearerToken, nil
+	}
+	if h.BearerTokenEnv != "" {
+		if token := os.Getenv(h.BearerTokenEnv); token != "" {
+			return token, nil
+		}
+	}
+	if h.BearerTokenFile != "" {
+		token, err := ioutil.ReadFile(h.BearerTokenFile)
+		if err != nil {
+			return "", errors.Wrap(err, "error reading bearer token file")
+		}
+		return strings.TrimSpace(string(token)), nil
+	}
+	return "", nil
+}
+
+func (h *HTTPSource) httpClient() (*http.Client, error) {
+	h.clientOnce.Do(func() {
+		h.client, h.clientErr = h.buildClient()
+	})
+	return h.client, h.clientErr
+}
+
+func (h *HTTPSource) buildClient() (*http.Client, error) {
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+		if h.CAFile != "" || h.CertFile != "" || h.KeyFile != "" {
+			tlsConfig, err := h.tlsConfig()
+			if err != nil {
+				return nil, err
+			}
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.TLSClientConfig = tlsConfig
+			client = &http.Client{
+				Transport: transport,
+			}
+		}
+	}
+
+	if h.Timeout > 0 {
+		withTimeout := *client
+		withTimeout.Timeout = h.Timeout
+		client = &withTimeout
+	}
+	return client, nil
+}
+
+func (h *HTTPSource) tlsConfig() (*tls.Config, error) {
+	tlsConfig := new(tls.Config)
+	if h.CAFile != "" {
+		pem, err := ioutil.ReadFile(h.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading CA file")
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("CA file does not contain any PEM certificates")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if h.CertFile != "" || h.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(h.CertFile, h.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "error loading client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// DirSource reads every config file in a directory, or every file matching a
+// glob such as dir:///etc/myapp/conf.d/*.yaml, and deep-merges them in
+// lexical order. Each file is decoded by the unmarshaller registered for its
+// own extension, so fragments in different formats can coexist. Like any
+// other config, fragments may be compressed, e.g. 10-routes.json.gz, or
+// encrypted with a registered Decrypter. Hidden files, subdirectories and
+// sidecar files named after another file, such as app.yaml.sig, are skipped.
+// The verifiers registered with Loader check each file on its own, reading
+// its sidecar files from the same directory. When another loader reads the
+// directory, its verifiers see the merged config as a SyntheticSource payload
+// instead, and those that require a digest or signature reject it.
+//
+// The merged config is decoded by DefaultKeyMapUnmarshaller, which matches
+// fields by their json tag or Go name, ignoring case. Format-specific tags
+// such as yaml or toml are not consulted, so a field renamed only by one of
+// them must also carry a json tag to be populated.
+type DirSource struct {
+	// Loader provides the unmarshallers used to decode each file. The
+	// package-level loader is used if it is nil.
+	Loader *Loader
+}
+
+func (d *DirSource) Protocols() []string {
+	return []string{"dir"}
+}
+
+func (d *DirSource) Format(url string) Unmarshaller {
+	return DefaultKeyMapUnmarshaller
+}
+
+func (d *DirSource) Synthetic(url string) bool {
+	return true
+}
+
+func (d *DirSource) verifiedBy(l *Loader) bool {
+	return d.loader() == l
+}
+
+func (d *DirSource) loader() *Loader {
+	if d.Loader == nil {
+		return defaultLoader
+	}
+	return d.Loader
+}
+
+func (d *DirSource) Reader(url string) (io.ReadCloser, error) {
+	loader := d.loader()
+
+	paths, err := d.paths(strings.TrimPrefix(url, "dir://"))
+	if err != nil {
+		return nil, err
+	}
+
+	merged := make(map[string]interface{})
+	for _, path := range paths {
+		formatPath, decompressor := loader.decompressorFor(path)
+		unmarshaller, err := loader.unmarshallerForPath(formatPath)
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "error opening config fragment")
+		}
+		fetch := func(suffix string) ([]byte, error) {
+			return ioutil.ReadFile(path + suffix)
+		}
+		buf, err := loader.readPayload(f, decompressor, unmarshaller, func(payload []byte) error {
+			return loader.verify("file://"+path, payload, fetch)
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("error reading config fragment %s", path))
+		}
+		keyMap, err := loader.unmarshalKeyMap(buf, unmarshaller)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("error reading config fragment %s", path))
+		}
+		mergeKeyMaps(merged, keyMap)
+	}
+	return encodeKeyMap(merged)
+}
+
+func (d *DirSource) paths(pattern string) ([]string, error) {
+	var candidates []string
+	if strings.ContainsAny(pattern, "*?[") {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid glob")
+		}
+		candidates = matches
+	} else {
+		infos, err := ioutil.ReadDir(pattern)
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading directory")
+		}
+		for _, info := range infos {
+			candidates = append(candidates, filepath.Join(pattern, info.Name()))
+		}
+	}
+
+	isCandidate := make(map[string]bool)
+	for _, candidate := range candidates {
+		isCandidate[candidate] = true
+	}
+	var paths []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(filepath.Base(candidate), ".") {
+			continue
+		}
+		// Sidecar files, such as app.yaml.sig next to app.yaml, aren't
+		// fragments of their own.
+		if isCandidate[strings.TrimSuffix(candidate, filepath.Ext(candidate))] {
+			continue
+		}
+		info, err := os.Stat(candidate)
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading config fragment")
+		}
+		if info.IsDir() {
+			continue
+		}
+		paths = append(paths, candidate)
+	}
+	return paths, nil
+}
+
+// FSSource reads configs from an fs.FS registered under a scheme of your
+// choosing. It's typically used with an embed.FS to ship default configs
+// inside the binary:
+//
+//	//go:embed defaults
+//	var defaults embed.FS
+//
+//	configurer.RegisterSource(configurer.NewFSSource("embed", defaults))
+//	configurer.LoadURLs(&cfg, "embed://defaults/app.yaml", "file:///etc/app.yaml")
+type FSSource struct {
+	scheme string
+	fsys   fs.FS
+}
+
+func NewFSSource(scheme string, fsys fs.FS) *FSSource {
+	return &FSSource{
+		scheme: scheme,
+		fsys:   fsys,
+	}
+}
+
+func (f *FSSource) Protocols() []string {
+	return []string{f.scheme}
+}
+
+func (f *FSSource) Reader(url string) (io.ReadCloser, error) {
+	name := strings.TrimPrefix(strings.TrimPrefix(url, f.scheme+"://"), "/")
+	return f.fsys.Open(name)
+}
+
+// StdinSource reads a config from standard input. Since there's no file name
+// to go by, the format is taken from the URL's extension, e.g. stdin://.yaml.
+// LoadURL also accepts - as shorthand, e.g. -.yaml.
+type StdinSource struct {
+	// In is read instead of os.Stdin if set.
+	In io.Reader
+}
+
+func (s *StdinSource) Protocols() []string {
+	return []string{"stdin"}
+}
+
+func (s *StdinSource) Reader(url string) (io.ReadCloser, error) {
+	if s.In != nil {
+		return ioutil.NopCloser(s.In), nil
+	}
+	return ioutil.NopCloser(os.Stdin), nil
+}
+
+// MemorySource serves configs registered at runtime, e.g. mem://test.toml.
+// It's mostly useful in tests, where it saves writing temporary files.
+type MemorySource struct {
+	mtx   sync.RWMutex
+	files map[string][]byte
+}
+
+var DefaultMemorySource = NewMemorySource()
+
+func NewMemorySource() *MemorySource {
+	return &MemorySource{
+		files: make(map[string][]byte),
+	}
+}
+
+func (m *MemorySource) Protocols() []string {
+	return []string{"mem"}
+}
+
+// Set registers data under name, replacing anything previously registered
+// under it.
+func (m *MemorySource) Set(name string, data []byte) {
+	buf := make([]byte, len(data))
+	copy(buf, data)
+	m.mtx.Lock()
+	m.files[name] = buf
+	m.mtx.Unlock()
+}
+
+func (m *MemorySource) Delete(name string) {
+	m.mtx.Lock()
+	delete(m.files, name)
+	m.mtx.Unlock()
+}
+
+func (m *MemorySource) Reader(url string) (io.ReadCloser, error) {
+	name := strings.TrimPrefix(url, "mem://")
+	m.mtx.RLock()
+	data, ok := m.files[name]
+	m.mtx.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no config registered under %s", name)
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// EnvSource builds a config from environment variables rather than a file.
+// The URL env://MYAPP selects every variable starting with MYAPP_, strips the
+// prefix, and splits the rest into nested keys on double underscores, so
+// MYAPP_DATABASE__HOST populates the Host field of the Database struct.
+// Numeric keys populate slices, so MYAPP_HOSTS__0 and MYAPP_HOSTS__1 make up
+// the Hosts slice. Fields are matched the same way as DefaultKeyMapUnmarshaller
+// does, and values are converted to the field's type.
+type EnvSource struct {
+}
+
+func (e *EnvSource) Protocols() []string {
+	return []string{"env"}
+}
+
+func (e *EnvSource) Format(url string) Unmarshaller {
+	return DefaultKeyMapUnmarshaller
+}
+
+func (e *EnvSource) Synthetic(url string) bool {
+	return true
+}
+
+func (e *EnvSource) Reader(url string) (io.ReadCloser, error) {
+	prefix := strings.TrimPrefix(url, "env://")
+	if prefix != "" {
+		prefix += "_"
+	}
+
+	keyMap := make(map[string]interface{})
+	for _, kv := range os.Environ() {
+		eqIdx := strings.Index(kv, "=")
+		if eqIdx == -1 {
+			continue
+		}
+		name := kv[:eqIdx]
+		if !strings.HasPrefix(name, prefix) || len(name) == len(prefix) {
+			continue
+		}
+		path := strings.Split(strings.ToLower(name[len(prefix):]), "__")
+		setKeyMapPath(keyMap, path, kv[eqIdx+1:])
+	}
+	return encodeKeyMap(keyMap)
+}
+
 func init() {
 	RegisterSource(new(FileSource))
 	RegisterSource(new(HTTPSource))
+	RegisterSource(new(DirSource))
+	RegisterSource(new(ConfigMapSource))
+	RegisterSource(new(EnvSource))
+	RegisterSource(new(StdinSource))
+	RegisterSource(DefaultMemorySource)
+	RegisterSource(new(ArchiveSource))
+	RegisterSource(new(GitSource))
+	RegisterSource(new(ConsulSource))
+	RegisterSource(new(EtcdSource))
+	RegisterSource(new(VaultSource))
+	RegisterSource(new(S3Source))
 }
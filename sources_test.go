@@ -1,13 +1,29 @@
 package configurer
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 	"io/ioutil"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 func TestHTTPSource(t *testing.T) {
@@ -42,3 +58,465 @@ func TestFileSource(t *testing.T) {
 	require.NoError(t, rd.Close())
 	require.NoError(t, os.Remove(tmp.Name()))
 }
+
+func TestDirSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configurer_")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"01-base.yaml":   "name: base\nport: 8080\ndatabase:\n  host: localhost\n  port: 5432\n",
+		"02-db.json":     `{"Database": {"Host": "db.internal"}}`,
+		"03-extra.toml":  "tags = [\"a\", \"b\"]\n",
+		"03-ids.json":    `{"ID": 9007199254740993, "Labels": {"App": "foo"}}`,
+		".hidden.yaml":   "name: hidden\n",
+		"sub/ignored.md": "not a config",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+
+	type cfg struct {
+		Name     string `config:"required"`
+		Port     int
+		Database struct {
+			Host string
+			Port int
+		}
+		Tags   []string
+		Extra  string `config:"default=extra"`
+		ID     int64
+		Labels map[string]string
+	}
+
+	actCfg := new(cfg)
+	require.NoError(t, LoadURL(fmt.Sprintf("dir://%s", dir), actCfg))
+	require.Equal(t, int64(9007199254740993), actCfg.ID)
+	require.Equal(t, map[string]string{"App": "foo"}, actCfg.Labels)
+	require.Equal(t, "base", actCfg.Name)
+	require.Equal(t, 8080, actCfg.Port)
+	require.Equal(t, "db.internal", actCfg.Database.Host)
+	require.Equal(t, 5432, actCfg.Database.Port)
+	require.Equal(t, []string{"a", "b"}, actCfg.Tags)
+	require.Equal(t, "extra", actCfg.Extra)
+
+	actCfg = new(cfg)
+	require.NoError(t, LoadURL(fmt.Sprintf("dir://%s/*.yaml", dir), actCfg))
+	require.Equal(t, "localhost", actCfg.Database.Host)
+	require.Empty(t, actCfg.Tags)
+
+	var gzipped bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	_, err = gzipWriter.Write([]byte(`{"Database": {"Port": 6543}}`))
+	require.NoError(t, err)
+	require.NoError(t, gzipWriter.Close())
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "03-routes.json.gz"), gzipped.Bytes(), 0644))
+	actCfg = new(cfg)
+	require.NoError(t, LoadURL(fmt.Sprintf("dir://%s", dir), actCfg))
+	require.Equal(t, "db.internal", actCfg.Database.Host)
+	require.Equal(t, 6543, actCfg.Database.Port)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "04-notes.txt"), []byte("hi"), 0644))
+	err = LoadURL(fmt.Sprintf("dir://%s", dir), new(cfg))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "can't find unmarshaller for extension txt")
+}
+
+func TestConfigMapSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configurer_")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeRevision := func(revision string, data map[string]string) {
+		revDir := filepath.Join(dir, revision)
+		require.NoError(t, os.Mkdir(revDir, 0755))
+		for k, v := range data {
+			require.NoError(t, ioutil.WriteFile(filepath.Join(revDir, k), []byte(v), 0644))
+			link := filepath.Join(dir, k)
+			if _, err := os.Lstat(link); os.IsNotExist(err) {
+				require.NoError(t, os.Symlink(filepath.Join("..data", k), link))
+			}
+		}
+		tmpLink := filepath.Join(dir, "..data_tmp")
+		require.NoError(t, os.Symlink(revision, tmpLink))
+		require.NoError(t, os.Rename(tmpLink, filepath.Join(dir, "..data")))
+	}
+
+	type cfg struct {
+		Name     string `config:"required"`
+		Database struct {
+			Host string
+			Port int `config:"default=5432"`
+		}
+	}
+
+	writeRevision("..2026_01_01", map[string]string{
+		"name":          "app\n",
+		"database.host": "db.internal",
+	})
+
+	source := &ConfigMapSource{PollInterval: 10 * time.Millisecond}
+	loader := NewLoader()
+	loader.RegisterSource(source)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	type reload struct {
+		cfg *cfg
+		err error
+	}
+	reloads := make(chan reload)
+	actCfg := new(cfg)
+	done := make(chan error)
+	go func() {
+		done <- loader.WatchURL(ctx, fmt.Sprintf("configmap://%s", dir), actCfg, func(v interface{}, err error) {
+			next, _ := v.(*cfg)
+			reloads <- reload{next, err}
+		})
+	}()
+
+	require.Eventually(t, func() bool {
+		source.mtx.Lock()
+		defer source.mtx.Unlock()
+		return source.revisions != nil
+	}, 5*time.Second, time.Millisecond)
+	writeRevision("..2026_01_02", map[string]string{
+		"name":          "app",
+		"database.host": "db2.internal",
+		"database.port": "6543",
+	})
+
+	select {
+	case reloaded := <-reloads:
+		require.NoError(t, reloaded.err)
+		require.Equal(t, "app", actCfg.Name)
+		require.Equal(t, "db.internal", actCfg.Database.Host)
+		require.Equal(t, 5432, actCfg.Database.Port)
+		require.Equal(t, "app", reloaded.cfg.Name)
+		require.Equal(t, "db2.internal", reloaded.cfg.Database.Host)
+		require.Equal(t, 6543, reloaded.cfg.Database.Port)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for reload")
+	}
+
+	cancel()
+	require.Equal(t, context.Canceled, <-done)
+}
+
+func TestConfigMapSource_Secret(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configurer_")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "tls.key"), []byte{0xff, 0xfe, 0x00, 0x41}, 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "username"), []byte("admin\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "labels.App"), []byte("web"), 0600))
+
+	type cfg struct {
+		TLS struct {
+			Key []byte
+		}
+		Username string
+		Labels   map[string]string
+	}
+
+	source := &ConfigMapSource{PollInterval: 10 * time.Millisecond}
+	loader := NewLoader()
+	loader.RegisterSource(source)
+
+	actCfg := new(cfg)
+	url := fmt.Sprintf("secret://%s", dir)
+	require.NoError(t, loader.LoadURL(url, actCfg))
+	require.Equal(t, []byte{0xff, 0xfe, 0x00, 0x41}, actCfg.TLS.Key)
+	require.Equal(t, "admin", actCfg.Username)
+	require.Equal(t, map[string]string{"App": "web"}, actCfg.Labels)
+
+	// Without a ..data symlink there's nothing to watch.
+	err = loader.WatchURL(context.Background(), url, new(cfg), func(v interface{}, err error) {})
+	require.True(t, errors.Is(err, errWatchUnsupported))
+}
+
+func TestEnvSource(t *testing.T) {
+	type cfg struct {
+		Name     string `config:"required"`
+		Port     int    `config:"default=8080"`
+		Debug    bool
+		Database struct {
+			Host     string
+			Password string
+		}
+		Hosts    []string
+		Backends []struct {
+			URL    string
+			Weight int
+		}
+	}
+
+	env := map[string]string{
+		"CONFIGURER_TEST_NAME":                  "app",
+		"CONFIGURER_TEST_DEBUG":                 "true",
+		"CONFIGURER_TEST_DATABASE__HOST":        "db.internal",
+		"CONFIGURER_TEST_DATABASE__PASSWORD":    "12345",
+		"CONFIGURER_TEST_HOSTS__1":              "b",
+		"CONFIGURER_TEST_HOSTS__0":              "a",
+		"CONFIGURER_TEST_BACKENDS__0__URL":      "http://one",
+		"CONFIGURER_TEST_BACKENDS__0__WEIGHT":   "2",
+		"CONFIGURER_TEST_BACKENDS__1__URL":      "http://two",
+		"CONFIGURER_TESTING_SHOULD_BE_IGNORED":  "x",
+		"CONFIGURER_TEST_UNRELATED_BUT_PRESENT": "x",
+	}
+	for k, v := range env {
+		require.NoError(t, os.Setenv(k, v))
+		defer os.Unsetenv(k)
+	}
+
+	actCfg := new(cfg)
+	require.NoError(t, LoadURL("env://CONFIGURER_TEST", actCfg))
+	require.Equal(t, "app", actCfg.Name)
+	require.Equal(t, 8080, actCfg.Port)
+	require.True(t, actCfg.Debug)
+	require.Equal(t, "db.internal", actCfg.Database.Host)
+	require.Equal(t, "12345", actCfg.Database.Password)
+	require.Equal(t, []string{"a", "b"}, actCfg.Hosts)
+	require.Len(t, actCfg.Backends, 2)
+	require.Equal(t, "http://one", actCfg.Backends[0].URL)
+	require.Equal(t, 2, actCfg.Backends[0].Weight)
+	require.Equal(t, "http://two", actCfg.Backends[1].URL)
+
+	require.NoError(t, os.Unsetenv("CONFIGURER_TEST_NAME"))
+	err := LoadURL("env://CONFIGURER_TEST", new(cfg))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "required field Name not found")
+}
+
+func TestFSSource(t *testing.T) {
+	fsys := fstest.MapFS{
+		"defaults/app.yaml": &fstest.MapFile{
+			Data: []byte("name: app\nport: 8080\ndatabase:\n  host: localhost\n  port: 5432\n"),
+		},
+	}
+	source := NewFSSource("embed", fsys)
+	require.EqualValues(t, []string{"embed"}, source.Protocols())
+
+	rd, err := source.Reader("embed://defaults/app.yaml")
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(rd)
+	require.NoError(t, err)
+	require.Equal(t, fsys["defaults/app.yaml"].Data, data)
+	require.NoError(t, rd.Close())
+
+	_, err = source.Reader("embed://defaults/missing.yaml")
+	require.Error(t, err)
+
+	mem := NewMemorySource()
+	mem.Set("override.json", []byte(`{"Port": 9090, "Database": {"Host": "db.internal"}}`))
+
+	type cfg struct {
+		Name     string `config:"required"`
+		Port     int
+		Database struct {
+			Host string `config:"required"`
+			Port int
+		}
+	}
+
+	loader := NewLoader()
+	loader.RegisterSource(source)
+	loader.RegisterSource(mem)
+	loader.RegisterUnmarshaller(DefaultJSONUnmarshaller)
+	loader.RegisterUnmarshaller(DefaultYAMLUnmarshaller)
+
+	actCfg := new(cfg)
+	require.NoError(t, loader.LoadURLs(actCfg, "embed://defaults/app.yaml", "mem://override.json"))
+	require.Equal(t, "app", actCfg.Name)
+	require.Equal(t, 9090, actCfg.Port)
+	require.Equal(t, "db.internal", actCfg.Database.Host)
+	require.Equal(t, 5432, actCfg.Database.Port)
+}
+
+func TestStdinSource(t *testing.T) {
+	type cfg struct {
+		Name string `config:"required"`
+		Port int
+	}
+
+	for _, url := range []string{"stdin://.yaml", "stdin://config.yaml", "-.yaml"} {
+		loader := NewLoader()
+		loader.RegisterSource(&StdinSource{In: strings.NewReader("name: app\nport: 8080\n")})
+		loader.RegisterUnmarshaller(DefaultYAMLUnmarshaller)
+
+		actCfg := new(cfg)
+		require.NoError(t, loader.LoadURL(url, actCfg))
+		require.Equal(t, "app", actCfg.Name)
+		require.Equal(t, 8080, actCfg.Port)
+	}
+
+	err := LoadURL("-", new(cfg))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "does not have a detectable file extension")
+}
+
+func TestMemorySource(t *testing.T) {
+	source := NewMemorySource()
+	require.EqualValues(t, []string{"mem"}, source.Protocols())
+
+	data := []byte("name = \"app\"")
+	source.Set("test.toml", data)
+	data[0] = 'x'
+
+	rd, err := source.Reader("mem://test.toml")
+	require.NoError(t, err)
+	read, err := ioutil.ReadAll(rd)
+	require.NoError(t, err)
+	require.Equal(t, "name = \"app\"", string(read))
+
+	source.Delete("test.toml")
+	_, err = source.Reader("mem://test.toml")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no config registered under test.toml")
+
+	DefaultMemorySource.Set("test.toml", []byte("name = \"default\""))
+	defer DefaultMemorySource.Delete("test.toml")
+	actCfg := new(struct {
+		Name string `toml:"name" config:"required"`
+	})
+	require.NoError(t, LoadURL("mem://test.toml", actCfg))
+	require.Equal(t, "default", actCfg.Name)
+}
+
+func TestHTTPSource_Headers(t *testing.T) {
+	var lastReq *http.Request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastReq = r
+		fmt.Fprint(w, "testing")
+	}))
+	defer ts.Close()
+
+	tokenFile, err := ioutil.TempFile("", "configurer_")
+	require.NoError(t, err)
+	defer os.Remove(tokenFile.Name())
+	_, err = tokenFile.Write([]byte("file-token\n"))
+	require.NoError(t, err)
+	require.NoError(t, tokenFile.Close())
+
+	source := &HTTPSource{
+		Header: http.Header{"X-Static": []string{"static"}},
+		HeaderFunc: func(url string) (http.Header, error) {
+			return http.Header{"X-Url": []string{url}}, nil
+		},
+		BearerTokenEnv:  "CONFIGURER_TEST_BEARER_TOKEN",
+		BearerTokenFile: tokenFile.Name(),
+	}
+	rd, err := source.Reader(ts.URL + "/app.yaml")
+	require.NoError(t, err)
+	require.NoError(t, rd.Close())
+	require.Equal(t, "static", lastReq.Header.Get("X-Static"))
+	require.Equal(t, ts.URL+"/app.yaml", lastReq.Header.Get("X-Url"))
+	require.Equal(t, "Bearer file-token", lastReq.Header.Get("Authorization"))
+
+	require.NoError(t, os.Setenv("CONFIGURER_TEST_BEARER_TOKEN", "env-token"))
+	defer os.Unsetenv("CONFIGURER_TEST_BEARER_TOKEN")
+	rd, err = source.Reader(ts.URL)
+	require.NoError(t, err)
+	require.NoError(t, rd.Close())
+	require.Equal(t, "Bearer env-token", lastReq.Header.Get("Authorization"))
+
+	source = &HTTPSource{
+		Username: "user",
+		Password: "pass",
+	}
+	rd, err = source.Reader(ts.URL)
+	require.NoError(t, err)
+	require.NoError(t, rd.Close())
+	user, pass, ok := lastReq.BasicAuth()
+	require.True(t, ok)
+	require.Equal(t, "user", user)
+	require.Equal(t, "pass", pass)
+}
+
+func TestHTTPSource_TLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configurer_")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	clientCert, clientCertPEM, clientKeyPEM := generateTestCert(t)
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	require.NoError(t, ioutil.WriteFile(certFile, clientCertPEM, 0600))
+	require.NoError(t, ioutil.WriteFile(keyFile, clientKeyPEM, 0600))
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "testing")
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	ts.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	ts.StartTLS()
+	defer ts.Close()
+
+	caFile := filepath.Join(dir, "ca.crt")
+	require.NoError(t, ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: ts.Certificate().Raw,
+	}), 0600))
+
+	_, err = (&HTTPSource{CAFile: caFile}).Reader(ts.URL)
+	require.Error(t, err)
+
+	source := &HTTPSource{
+		CAFile:   caFile,
+		CertFile: certFile,
+		KeyFile:  keyFile,
+		Timeout:  5 * time.Second,
+	}
+	rd, err := source.Reader(ts.URL)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(rd)
+	require.NoError(t, err)
+	require.Equal(t, "testing", string(data))
+}
+
+func TestHTTPSource_Timeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		fmt.Fprint(w, "testing")
+	}))
+	defer ts.Close()
+
+	_, err := (&HTTPSource{Timeout: 10 * time.Millisecond}).Reader(ts.URL)
+	require.Error(t, err)
+
+	_, err = (&HTTPSource{Client: ts.Client(), Timeout: 10 * time.Millisecond}).Reader(ts.URL)
+	require.Error(t, err)
+	require.Zero(t, ts.Client().Timeout)
+}
+
+func generateTestCert(t *testing.T) (*x509.Certificate, []byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "configurer test client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return cert, certPEM, keyPEM
+}
@@ -6,7 +6,6 @@ import (
 	"gopkg.in/yaml.v2"
 	"os"
 	"reflect"
-	"strings"
 )
 
 const (
@@ -20,7 +19,21 @@ type FieldConfig struct {
 	Defined  bool
 }
 
+// keyMapResolver is implemented by unmarshallers whose key maps must be
+// adjusted to the shape of the config struct before fields are looked up in
+// them, such as DotenvUnmarshaller.
+type keyMapResolver interface {
+	resolveKeyMap(keyMap map[string]interface{}, t reflect.Type) map[string]interface{}
+}
+
 func processTags(v interface{}, unmarshaller Unmarshaller, keyMap map[string]interface{}) error {
+	if resolver, ok := unmarshaller.(keyMapResolver); ok {
+		keyMap = resolver.resolveKeyMap(keyMap, reflect.TypeOf(v))
+	}
+	return processStructTags(v, unmarshaller, keyMap)
+}
+
+func processStructTags(v interface{}, unmarshaller Unmarshaller, keyMap map[string]interface{}) error {
 	cfgVal := reflect.Indirect(reflect.ValueOf(v))
 	if cfgVal.Kind() == reflect.Interface {
 		cfgVal = cfgVal.Elem()
@@ -44,8 +57,7 @@ func processTags(v interface{}, unmarshaller Unmarshaller, keyMap map[string]int
 			envOverride, _ = os.LookupEnv(fieldCfg.Env)
 		}
 
-		fieldName := strings.ToLower(unmarshaller.ExtractFieldName(fieldDef))
-		rawFieldVal, rawFieldIsDefined := keyMap[fieldName]
+		_, rawFieldVal, rawFieldIsDefined := lookupKeyMap(keyMap, unmarshaller.ExtractFieldName(fieldDef))
 		rawFieldIsNil := rawFieldIsDefined && rawFieldVal == nil
 		hasDefault := envOverride != "" || fieldCfg.Default != ""
 		derefFieldVal := fieldVal
@@ -99,10 +111,16 @@ func processTags(v interface{}, unmarshaller Unmarshaller, keyMap map[string]int
 				continue
 			}
 
-			nextKeyMapVal := reflect.ValueOf(rawFieldVal)
+			nextKeyMapVals := keyMapItems(rawFieldVal)
 			for i := 0; i < sliceLen; i++ {
-				next := nextKeyMapVal.Index(i).Interface().(map[string]interface{})
-				if err := processTags(derefFieldVal.Index(i).Addr().Interface(), unmarshaller, next); err != nil {
+				var next map[string]interface{}
+				if i < len(nextKeyMapVals) {
+					next, _ = nextKeyMapVals[i].(map[string]interface{})
+				}
+				if next == nil {
+					next = make(map[string]interface{})
+				}
+				if err := processStructTags(derefFieldVal.Index(i).Addr().Interface(), unmarshaller, next); err != nil {
 					return errors.Wrap(err, fmt.Sprintf("error processing array field %s", fieldDef.Name))
 				}
 			}
@@ -110,14 +128,13 @@ func processTags(v interface{}, unmarshaller Unmarshaller, keyMap map[string]int
 		}
 
 		if derefFieldValKind == reflect.Struct {
-			if rawFieldVal == nil {
-				if err := processTags(derefFieldVal.Addr().Interface(), unmarshaller, make(map[string]interface{})); err != nil {
-					return errors.Wrap(err, fmt.Sprintf("error processing field %s", fieldDef.Name))
-				}
-				continue
+			// Formats like XML can represent an empty struct as an empty
+			// value rather than an empty map.
+			next, _ := rawFieldVal.(map[string]interface{})
+			if next == nil {
+				next = make(map[string]interface{})
 			}
-
-			if err := processTags(derefFieldVal.Addr().Interface(), unmarshaller, rawFieldVal.(map[string]interface{})); err != nil {
+			if err := processStructTags(derefFieldVal.Addr().Interface(), unmarshaller, next); err != nil {
 				return errors.Wrap(err, fmt.Sprintf("error processing field %s", fieldDef.Name))
 			}
 		}
@@ -1,10 +1,13 @@
 package configurer
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
+	"io"
 	"reflect"
 	"strings"
 )
@@ -65,7 +68,28 @@ func (j *JSONUnmarshaller) ExtractFieldName(field reflect.StructField) string {
 }
 
 func (j *JSONUnmarshaller) Unmarshal(data []byte, v interface{}) error {
-	return json.Unmarshal(data, v)
+	return unmarshalJSON(data, v)
+}
+
+// unmarshalJSON is like json.Unmarshal, but decodes numbers into key maps as
+// int64s where possible rather than float64s, so that large integers keep
+// their precision when configs are merged.
+func unmarshalJSON(data []byte, v interface{}) error {
+	mapPtr, ok := v.(*map[string]interface{})
+	if !ok {
+		return json.Unmarshal(data, v)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	keyMap := make(map[string]interface{})
+	if err := decoder.Decode(&keyMap); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("invalid character after top-level value")
+	}
+	*mapPtr = keyMapNumbers(keyMap).(map[string]interface{})
+	return nil
 }
 
 type YAMLUnmarshaller struct {
@@ -97,7 +121,14 @@ func (y *YAMLUnmarshaller) Unmarshal(data []byte, v interface{}) error {
 		if err := yaml.Unmarshal(data, &res); err != nil {
 			return err
 		}
-		mapVal := y.cleanupMapValue(res).(map[string]interface{})
+		if res == nil {
+			*v = make(map[string]interface{})
+			return nil
+		}
+		mapVal, ok := y.cleanupMapValue(res).(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected a map at the top level but got %T", res)
+		}
 		*v = mapVal
 		return nil
 	default:
@@ -132,8 +163,47 @@ func (y *YAMLUnmarshaller) cleanupInterfaceMap(in map[interface{}]interface{}) m
 	return res
 }
 
+// KeyMapUnmarshaller decodes the JSON-encoded key maps produced by sources
+// that assemble a config from something other than a single file, such as
+// DirSource. Field names are extracted the same way as JSONUnmarshaller does
+// and matched case-insensitively, while map keys keep their case. Scalars are
+// converted as needed, so string values can populate numeric fields and vice
+// versa.
+type KeyMapUnmarshaller struct {
+}
+
+var DefaultKeyMapUnmarshaller = new(KeyMapUnmarshaller)
+
+// Extensions returns nothing, since key maps are never picked by file
+// extension. Sources select this unmarshaller through FormatSource.
+func (k *KeyMapUnmarshaller) Extensions() []string {
+	return nil
+}
+
+func (k *KeyMapUnmarshaller) ExtractFieldName(field reflect.StructField) string {
+	return DefaultJSONUnmarshaller.ExtractFieldName(field)
+}
+
+func (k *KeyMapUnmarshaller) Unmarshal(data []byte, v interface{}) error {
+	keyMap := make(map[string]interface{})
+	if err := unmarshalJSON(data, &keyMap); err != nil {
+		return err
+	}
+	if mapPtr, ok := v.(*map[string]interface{}); ok {
+		*mapPtr = keyMap
+		return nil
+	}
+	return decodeKeyMap(keyMap, v, k.ExtractFieldName)
+}
+
 func init() {
 	RegisterUnmarshaller(DefaultTOMLUnmarshaller)
 	RegisterUnmarshaller(DefaultJSONUnmarshaller)
 	RegisterUnmarshaller(DefaultYAMLUnmarshaller)
+	RegisterUnmarshaller(DefaultHCLUnmarshaller)
+	RegisterUnmarshaller(DefaultINIUnmarshaller)
+	RegisterUnmarshaller(DefaultDotenvUnmarshaller)
+	RegisterUnmarshaller(DefaultPropertiesUnmarshaller)
+	RegisterUnmarshaller(DefaultXMLUnmarshaller)
+	RegisterUnmarshaller(DefaultJSON5Unmarshaller)
 }
@@ -0,0 +1,376 @@
+package configurer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VaultSource reads secrets from HashiCorp Vault's HTTP API, e.g.
+// vault://127.0.0.1:8200/secret/data/myapp. The URL's path is the API path
+// below /v1/, so KV v2 secrets are read through their data/ path. Both KV v1
+// and KV v2 responses are understood, as are dynamic secrets with leases.
+//
+// A secret's fields populate the top level of the config, or the subtree
+// named by the key query parameter, e.g.
+// vault://127.0.0.1:8200/secret/data/db?key=database populates the Database
+// struct. This makes it easy to layer secrets over a config file with
+// LoadURLs. Secrets are decoded by DefaultKeyMapUnmarshaller.
+//
+// VaultSource authenticates with Token, or the VAULT_TOKEN environment
+// variable if it's empty. If RoleID is set, it logs in with AppRole instead
+// and renews the resulting token as it nears expiry, logging in again when
+// it can't be renewed.
+//
+// Watch polls KV secrets for a new version. For secrets with a lease, it
+// renews the lease while it's renewable and reports a change once it runs
+// out, so that the caller reloads fresh credentials.
+type VaultSource struct {
+	// Scheme is used to reach Vault. Defaults to https.
+	Scheme string
+	// Token authenticates requests. Defaults to the VAULT_TOKEN environment
+	// variable.
+	Token string
+	// RoleID and SecretID log in with AppRole. SecretID may be empty if the
+	// role doesn't require one.
+	RoleID   string
+	SecretID string
+	// AppRoleMount is the mount path of the AppRole auth method. Defaults to
+	// approle.
+	AppRoleMount string
+	// Namespace is sent in the X-Vault-Namespace header if set.
+	Namespace string
+	// Client is used to make requests. Defaults to http.DefaultClient.
+	Client *http.Client
+	// PollInterval is how often Watch checks KV secrets for a new version.
+	// Defaults to one minute.
+	PollInterval time.Duration
+
+	mtx         sync.Mutex
+	token       string
+	tokenExpiry time.Time
+	tokenTTL    time.Duration
+	tokenRenew  bool
+	secrets     map[string]*vaultSecretState
+}
+
+type vaultSecretState struct {
+	hash      string
+	leaseID   string
+	renewable bool
+	expiry    time.Time
+	ttl       time.Duration
+}
+
+type vaultSecret struct {
+	LeaseID       string                 `json:"lease_id"`
+	LeaseDuration int                    `json:"lease_duration"`
+	Renewable     bool                   `json:"renewable"`
+	Data          map[string]interface{} `json:"data"`
+	Auth          *vaultAuth             `json:"auth"`
+}
+
+type vaultAuth struct {
+	ClientToken   string `json:"client_token"`
+	LeaseDuration int    `json:"lease_duration"`
+	Renewable     bool   `json:"renewable"`
+}
+
+func (v *VaultSource) Protocols() []string {
+	return []string{"vault"}
+}
+
+func (v *VaultSource) Format(url string) Unmarshaller {
+	return DefaultKeyMapUnmarshaller
+}
+
+func (v *VaultSource) Synthetic(url string) bool {
+	return true
+}
+
+func (v *VaultSource) Reader(url string) (io.ReadCloser, error) {
+	secret, err := v.read(context.Background(), url)
+	if err != nil {
+		return nil, err
+	}
+	data := vaultSecretData(secret)
+	keyMap := data
+	if _, _, query := v.location(url); query.Get("key") != "" {
+		keyMap = make(map[string]interface{})
+		setKeyMapPath(keyMap, strings.Split(query.Get("key"), "."), data)
+	}
+
+	state := &vaultSecretState{
+		hash:      vaultHash(data),
+		leaseID:   secret.LeaseID,
+		renewable: secret.Renewable,
+		ttl:       time.Duration(secret.LeaseDuration) * time.Second,
+	}
+	state.expiry = time.Now().Add(state.ttl)
+	v.mtx.Lock()
+	if v.secrets == nil {
+		v.secrets = make(map[string]*vaultSecretState)
+	}
+	v.secrets[url] = state
+	v.mtx.Unlock()
+
+	return encodeKeyMap(keyMap)
+}
+
+func (v *VaultSource) Watch(ctx context.Context, url string) error {
+	v.mtx.Lock()
+	state, ok := v.secrets[url]
+	v.mtx.Unlock()
+	if !ok {
+		rd, err := v.Reader(url)
+		if err != nil {
+			return err
+		}
+		rd.Close()
+		v.mtx.Lock()
+		state = v.secrets[url]
+		v.mtx.Unlock()
+	}
+
+	interval := v.PollInterval
+	if interval == 0 {
+		interval = time.Minute
+	}
+	for {
+		wait := interval
+		v.mtx.Lock()
+		leased, renewable := state.leaseID != "", state.renewable
+		if leased {
+			// Renew once half the lease has elapsed, or reload when it's due
+			// to expire and can't be renewed.
+			wait = time.Until(state.expiry.Add(-state.ttl / 2))
+			if !renewable {
+				wait = time.Until(state.expiry)
+			}
+		}
+		v.mtx.Unlock()
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		if leased {
+			if !renewable {
+				return nil
+			}
+			host, _, _ := v.location(url)
+			renewed, err := v.renewLease(ctx, host, state)
+			if err != nil || !renewed {
+				return nil
+			}
+			continue
+		}
+
+		secret, err := v.read(ctx, url)
+		if err != nil {
+			return err
+		}
+		if vaultHash(vaultSecretData(secret)) != state.hash {
+			return nil
+		}
+	}
+}
+
+// renewLease extends the lease behind state. It reports false when Vault no
+// longer extends the lease, since it will soon expire regardless.
+func (v *VaultSource) renewLease(ctx context.Context, host string, state *vaultSecretState) (bool, error) {
+	var secret vaultSecret
+	err := v.do(ctx, host, http.MethodPut, "sys/leases/renew", map[string]interface{}{
+		"lease_id":  state.leaseID,
+		"increment": int(state.ttl.Seconds()),
+	}, &secret)
+	if err != nil {
+		return false, err
+	}
+	ttl := time.Duration(secret.LeaseDuration) * time.Second
+	if ttl <= 0 {
+		return false, nil
+	}
+	v.mtx.Lock()
+	state.expiry = time.Now().Add(ttl)
+	state.renewable = secret.Renewable
+	extended := ttl >= state.ttl/2
+	v.mtx.Unlock()
+	return extended, nil
+}
+
+func (v *VaultSource) read(ctx context.Context, url string) (*vaultSecret, error) {
+	host, path, _ := v.location(url)
+	var secret vaultSecret
+	if err := v.do(ctx, host, http.MethodGet, path, nil, &secret); err != nil {
+		if statusErr, ok := errors.Cause(err).(*StatusError); ok && statusErr.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("secret %s not found in Vault", path)
+		}
+		return nil, err
+	}
+	return &secret, nil
+}
+
+// do sends an authenticated request to the API path below /v1/ and decodes
+// the response into out.
+func (v *VaultSource) do(ctx context.Context, host string, method string, path string, body interface{}, out interface{}) error {
+	token, err := v.authToken(ctx, host)
+	if err != nil {
+		return err
+	}
+	return v.request(ctx, host, method, path, token, body, out)
+}
+
+func (v *VaultSource) request(ctx context.Context, host string, method string, path string, token string, body interface{}, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return errors.Wrap(err, "error encoding Vault request")
+		}
+		reqBody = bytes.NewReader(buf)
+	}
+	scheme := v.Scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+	req, err := http.NewRequest(method, fmt.Sprintf("%s://%s/v1/%s", scheme, host, path), reqBody)
+	if err != nil {
+		return errors.Wrap(err, "error creating request")
+	}
+	req = req.WithContext(ctx)
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "error querying Vault")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return &StatusError{
+			StatusCode: res.StatusCode,
+		}
+	}
+	decoder := json.NewDecoder(res.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(out); err != nil {
+		return errors.Wrap(err, "error decoding Vault response")
+	}
+	return nil
+}
+
+// authToken returns the token to authenticate requests with, logging in with
+// AppRole or renewing the current token as needed.
+func (v *VaultSource) authToken(ctx context.Context, host string) (string, error) {
+	if v.RoleID == "" {
+		if v.Token != "" {
+			return v.Token, nil
+		}
+		return os.Getenv("VAULT_TOKEN"), nil
+	}
+
+	v.mtx.Lock()
+	token, expiry, ttl, renewable := v.token, v.tokenExpiry, v.tokenTTL, v.tokenRenew
+	v.mtx.Unlock()
+	if token != "" && (ttl == 0 || time.Until(expiry) > ttl/3) {
+		return token, nil
+	}
+	if token != "" && renewable {
+		var secret vaultSecret
+		err := v.request(ctx, host, http.MethodPost, "auth/token/renew-self", token, map[string]interface{}{}, &secret)
+		if err == nil && secret.Auth != nil && secret.Auth.LeaseDuration > 0 {
+			v.setToken(secret.Auth)
+			return secret.Auth.ClientToken, nil
+		}
+	}
+
+	mount := v.AppRoleMount
+	if mount == "" {
+		mount = "approle"
+	}
+	login := map[string]string{
+		"role_id": v.RoleID,
+	}
+	if v.SecretID != "" {
+		login["secret_id"] = v.SecretID
+	}
+	var secret vaultSecret
+	if err := v.request(ctx, host, http.MethodPost, fmt.Sprintf("auth/%s/login", mount), "", login, &secret); err != nil {
+		return "", errors.Wrap(err, "error logging in to Vault with AppRole")
+	}
+	if secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return "", errors.New("Vault AppRole login returned no token")
+	}
+	v.setToken(secret.Auth)
+	return secret.Auth.ClientToken, nil
+}
+
+func (v *VaultSource) setToken(auth *vaultAuth) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	if auth.ClientToken != "" {
+		v.token = auth.ClientToken
+	}
+	v.tokenTTL = time.Duration(auth.LeaseDuration) * time.Second
+	v.tokenExpiry = time.Now().Add(v.tokenTTL)
+	v.tokenRenew = auth.Renewable
+}
+
+func (v *VaultSource) location(url string) (string, string, neturl.Values) {
+	location := strings.TrimPrefix(url, "vault://")
+	query := make(neturl.Values)
+	if queryIdx := strings.Index(location, "?"); queryIdx != -1 {
+		query, _ = neturl.ParseQuery(location[queryIdx+1:])
+		location = location[:queryIdx]
+	}
+	slashIdx := strings.Index(location, "/")
+	if slashIdx == -1 {
+		return location, "", query
+	}
+	return location[:slashIdx], strings.Trim(location[slashIdx+1:], "/"), query
+}
+
+// vaultSecretData returns a secret's fields, unwrapping the extra level of
+// data and metadata that KV v2 responses have.
+func vaultSecretData(secret *vaultSecret) map[string]interface{} {
+	inner, ok := secret.Data["data"].(map[string]interface{})
+	if _, hasMetadata := secret.Data["metadata"]; ok && hasMetadata && len(secret.Data) == 2 {
+		return inner
+	}
+	if secret.Data == nil {
+		return make(map[string]interface{})
+	}
+	return secret.Data
+}
+
+func vaultHash(data map[string]interface{}) string {
+	buf, _ := json.Marshal(data)
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,233 @@
+package configurer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeVault struct {
+	mtx         sync.Mutex
+	secrets     map[string]map[string]interface{}
+	versions    map[string]int
+	token       string
+	tokenTTL    int
+	logins      int
+	renewals    int
+	renewFails  bool
+	leaseRenews int
+}
+
+func newFakeVault() *fakeVault {
+	return &fakeVault{
+		secrets:  make(map[string]map[string]interface{}),
+		versions: make(map[string]int),
+	}
+}
+
+func (f *fakeVault) put(path string, data map[string]interface{}) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.secrets[path] = data
+	f.versions[path]++
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	var body map[string]interface{}
+	if r.Body != nil {
+		json.NewDecoder(r.Body).Decode(&body)
+	}
+	enc := json.NewEncoder(w)
+
+	if path == "auth/approle/login" {
+		if body["role_id"] != "role" || body["secret_id"] != "s3cr3t" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.logins++
+		f.token = fmt.Sprintf("token-%d", f.logins)
+		enc.Encode(map[string]interface{}{
+			"auth": vaultAuth{ClientToken: f.token, LeaseDuration: f.tokenTTL, Renewable: true},
+		})
+		return
+	}
+	if r.Header.Get("X-Vault-Token") != f.token {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	switch {
+	case path == "auth/token/renew-self":
+		if f.renewFails {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		f.renewals++
+		enc.Encode(map[string]interface{}{
+			"auth": vaultAuth{ClientToken: f.token, LeaseDuration: f.tokenTTL, Renewable: true},
+		})
+	case path == "sys/leases/renew":
+		f.leaseRenews++
+		ttl := 1
+		if f.leaseRenews > 1 {
+			ttl = 0
+		}
+		enc.Encode(vaultSecret{LeaseID: body["lease_id"].(string), LeaseDuration: ttl, Renewable: ttl > 0})
+	case path == "database/creds/app":
+		enc.Encode(vaultSecret{
+			LeaseID:       "database/creds/app/1",
+			LeaseDuration: 1,
+			Renewable:     true,
+			Data:          map[string]interface{}{"username": "v-app-1", "password": "generated"},
+		})
+	case strings.HasPrefix(path, "secret/data/"):
+		data, ok := f.secrets[strings.TrimPrefix(path, "secret/data/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		enc.Encode(vaultSecret{Data: map[string]interface{}{
+			"data":     data,
+			"metadata": map[string]interface{}{"version": f.versions[strings.TrimPrefix(path, "secret/data/")]},
+		}})
+	default:
+		data, ok := f.secrets[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		enc.Encode(vaultSecret{LeaseDuration: 2764800, Data: data})
+	}
+}
+
+func TestVaultSource(t *testing.T) {
+	vault := newFakeVault()
+	vault.token = "root"
+	vault.put("kv/app", map[string]interface{}{"Name": "app", "Labels": map[string]interface{}{"Team": "payments"}})
+	vault.put("db", map[string]interface{}{"username": "app", "password": "hunter2", "port": "5432"})
+	ts := httptest.NewServer(vault)
+	defer ts.Close()
+	host := strings.TrimPrefix(ts.URL, "http://")
+
+	source := &VaultSource{
+		Scheme:       "http",
+		Token:        "root",
+		PollInterval: 10 * time.Millisecond,
+	}
+	loader := NewLoader()
+	loader.RegisterSource(source)
+
+	type cfg struct {
+		Name     string `config:"required"`
+		Labels   map[string]string
+		Database struct {
+			Username string
+			Password string `config:"required"`
+			Port     int
+		}
+	}
+
+	kvURL := fmt.Sprintf("vault://%s/kv/app", host)
+	dbURL := fmt.Sprintf("vault://%s/secret/data/db?key=database", host)
+	actCfg := new(cfg)
+	require.NoError(t, loader.LoadURLs(actCfg, kvURL, dbURL))
+	require.Equal(t, "app", actCfg.Name)
+	require.Equal(t, "app", actCfg.Database.Username)
+	require.Equal(t, "hunter2", actCfg.Database.Password)
+	require.Equal(t, 5432, actCfg.Database.Port)
+	require.Equal(t, map[string]string{"Team": "payments"}, actCfg.Labels)
+
+	_, err := source.Reader(fmt.Sprintf("vault://%s/secret/data/missing", host))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "secret secret/data/missing not found in Vault")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- source.Watch(ctx, dbURL)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	vault.put("db", map[string]interface{}{"username": "app", "password": "rotated", "port": "5432"})
+	require.NoError(t, <-done)
+
+	source.Token = "wrong"
+	_, err = source.Reader(kvURL)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "expected 200 response code but got 403")
+}
+
+func TestVaultSource_AppRole(t *testing.T) {
+	vault := newFakeVault()
+	vault.tokenTTL = 1
+	vault.put("kv/app", map[string]interface{}{"name": "app"})
+	ts := httptest.NewServer(vault)
+	defer ts.Close()
+	url := fmt.Sprintf("vault://%s/kv/app", strings.TrimPrefix(ts.URL, "http://"))
+
+	source := &VaultSource{
+		Scheme:   "http",
+		RoleID:   "role",
+		SecretID: "s3cr3t",
+	}
+	read := func() {
+		rd, err := source.Reader(url)
+		require.NoError(t, err)
+		rd.Close()
+	}
+
+	read()
+	read()
+	require.Equal(t, 1, vault.logins)
+	require.Equal(t, 0, vault.renewals)
+
+	time.Sleep(700 * time.Millisecond)
+	read()
+	require.Equal(t, 1, vault.logins)
+	require.Equal(t, 1, vault.renewals)
+
+	vault.mtx.Lock()
+	vault.renewFails = true
+	vault.mtx.Unlock()
+	time.Sleep(700 * time.Millisecond)
+	read()
+	require.Equal(t, 2, vault.logins)
+}
+
+func TestVaultSource_Lease(t *testing.T) {
+	vault := newFakeVault()
+	vault.token = "root"
+	ts := httptest.NewServer(vault)
+	defer ts.Close()
+	url := fmt.Sprintf("vault://%s/database/creds/app?key=database", strings.TrimPrefix(ts.URL, "http://"))
+
+	source := &VaultSource{
+		Scheme: "http",
+		Token:  "root",
+	}
+	loader := NewLoader()
+	loader.RegisterSource(source)
+	actCfg := new(struct {
+		Database struct {
+			Username string
+			Password string
+		}
+	})
+	require.NoError(t, loader.LoadURL(url, actCfg))
+	require.Equal(t, "v-app-1", actCfg.Database.Username)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, source.Watch(ctx, url))
+	require.Equal(t, 2, vault.leaseRenews)
+}
@@ -0,0 +1,113 @@
+package configurer
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+const digestFragment = "#sha256="
+
+// Verifier checks a raw config payload before it's unmarshalled, so that
+// tampered configs are rejected outright. Verifiers are registered with
+// RegisterVerifier.
+type Verifier interface {
+	// Verify returns an error if payload, read from url, can't be trusted.
+	// fetch reads a sidecar file from the same source, whose URL is the
+	// config's URL with suffix appended to its path. When a payload is
+	// loaded from a reader rather than a URL, url is empty and fetch is nil.
+	// Payloads from a SyntheticSource are verified with an empty url and a
+	// nil fetch as well.
+	Verify(url string, payload []byte, fetch func(suffix string) ([]byte, error)) error
+}
+
+// splitDigestFragment splits a #sha256=<hex> fragment off the end of url.
+func splitDigestFragment(url string) (string, string) {
+	idx := strings.LastIndex(url, digestFragment)
+	if idx == -1 {
+		return url, ""
+	}
+	return url[:idx], url[idx+len(digestFragment):]
+}
+
+// DigestVerifier checks payloads against a SHA-256 digest. The digest is
+// taken from the URL's fragment, e.g. https://host/app.yaml#sha256=<hex>,
+// or, if Sidecar is set, from a sidecar file such as app.yaml.sha256 in the
+// format written by sha256sum.
+type DigestVerifier struct {
+	// Sidecar enables reading digests from sidecar files when the URL
+	// doesn't include one.
+	Sidecar bool
+	// Required rejects payloads that have no digest to check against.
+	// Without it, payloads without a digest are accepted, so a missing
+	// sidecar file goes unnoticed.
+	Required bool
+}
+
+func (d *DigestVerifier) Verify(url string, payload []byte, fetch func(suffix string) ([]byte, error)) error {
+	_, expected := splitDigestFragment(url)
+	if expected == "" && d.Sidecar && fetch != nil {
+		if sidecar, err := fetch(".sha256"); err == nil {
+			fields := strings.Fields(string(sidecar))
+			if len(fields) > 0 {
+				expected = fields[0]
+			}
+		}
+	}
+	if expected == "" {
+		if d.Required {
+			return errors.New("no SHA-256 digest to verify against")
+		}
+		return nil
+	}
+
+	expectedSum, err := hex.DecodeString(expected)
+	if err != nil || len(expectedSum) != sha256.Size {
+		return errors.New("mal-formed SHA-256 digest")
+	}
+	actualSum := sha256.Sum256(payload)
+	if subtle.ConstantTimeCompare(expectedSum, actualSum[:]) != 1 {
+		return fmt.Errorf("SHA-256 digest mismatch: expected %s but got %x", expected, actualSum)
+	}
+	return nil
+}
+
+// SignatureVerifier checks payloads against a detached ed25519 signature
+// read from a sidecar file such as app.yaml.sig, either raw or
+// base64-encoded. A payload is accepted if any of PublicKeys signed it.
+type SignatureVerifier struct {
+	PublicKeys []ed25519.PublicKey
+}
+
+func (s *SignatureVerifier) Verify(url string, payload []byte, fetch func(suffix string) ([]byte, error)) error {
+	if fetch == nil {
+		return errors.New("no signature to verify against")
+	}
+	sig, err := fetch(".sig")
+	if err != nil {
+		return errors.Wrap(err, "error reading signature")
+	}
+	if len(sig) != ed25519.SignatureSize {
+		decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig)))
+		if err != nil {
+			return errors.New("mal-formed signature")
+		}
+		sig = decoded
+	}
+	if len(sig) != ed25519.SignatureSize {
+		return errors.New("mal-formed signature")
+	}
+
+	for _, key := range s.PublicKeys {
+		if ed25519.Verify(key, payload, sig) {
+			return nil
+		}
+	}
+	return errors.New("signature does not match any trusted public key")
+}
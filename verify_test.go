@@ -0,0 +1,177 @@
+package configurer
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type verifyTestConfig struct {
+	Name string `config:"required"`
+}
+
+func newVerifyTestLoader(verifier Verifier) (*Loader, *MemorySource) {
+	mem := NewMemorySource()
+	loader := NewLoader()
+	loader.RegisterSource(mem)
+	loader.RegisterUnmarshaller(DefaultJSONUnmarshaller)
+	loader.RegisterVerifier(verifier)
+	return loader, mem
+}
+
+func TestDigestVerifier(t *testing.T) {
+	payload := []byte(`{"Name": "app"}`)
+	digest := fmt.Sprintf("%x", sha256.Sum256(payload))
+
+	loader, mem := newVerifyTestLoader(new(DigestVerifier))
+	mem.Set("app.json", payload)
+	actCfg := new(verifyTestConfig)
+	require.NoError(t, loader.LoadURL("mem://app.json#sha256="+digest, actCfg))
+	require.Equal(t, "app", actCfg.Name)
+	require.NoError(t, loader.LoadURL("mem://app.json", new(verifyTestConfig)))
+
+	mem.Set("app.json", []byte(`{"Name": "tampered"`))
+	err := loader.LoadURL("mem://app.json#sha256="+digest, new(verifyTestConfig))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "SHA-256 digest mismatch")
+	require.NotContains(t, err.Error(), "unmarshalling")
+
+	err = loader.LoadURL("mem://app.json#sha256=nothex", new(verifyTestConfig))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "mal-formed SHA-256 digest")
+
+	loader, mem = newVerifyTestLoader(&DigestVerifier{Sidecar: true, Required: true})
+	mem.Set("app.json", payload)
+	err = loader.LoadURL("mem://app.json", new(verifyTestConfig))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no SHA-256 digest to verify against")
+
+	mem.Set("app.json.sha256", []byte(digest+"  app.json\n"))
+	require.NoError(t, loader.LoadURL("mem://app.json", new(verifyTestConfig)))
+
+	mem.Set("app.json", []byte(`{"Name": "tampered"}`))
+	err = loader.LoadURL("mem://app.json", new(verifyTestConfig))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "SHA-256 digest mismatch")
+}
+
+func TestSignatureVerifier(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	otherPub, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	payload := []byte(`{"Name": "app"}`)
+	loader, mem := newVerifyTestLoader(&SignatureVerifier{PublicKeys: []ed25519.PublicKey{otherPub, pub}})
+	mem.Set("app.json", payload)
+
+	err = loader.LoadURL("mem://app.json", new(verifyTestConfig))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "error reading signature")
+
+	mem.Set("app.json.sig", ed25519.Sign(priv, payload))
+	actCfg := new(verifyTestConfig)
+	require.NoError(t, loader.LoadURL("mem://app.json", actCfg))
+	require.Equal(t, "app", actCfg.Name)
+
+	mem.Set("app.json.sig", []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(otherPriv, payload))+"\n"))
+	require.NoError(t, loader.LoadURL("mem://app.json", new(verifyTestConfig)))
+
+	mem.Set("app.json", []byte(`{"Name": "tampered"}`))
+	err = loader.LoadURL("mem://app.json", new(verifyTestConfig))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "signature does not match any trusted public key")
+
+	_, untrustedPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	mem.Set("app.json.sig", ed25519.Sign(untrustedPriv, []byte(`{"Name": "tampered"}`)))
+	err = loader.LoadURL("mem://app.json", new(verifyTestConfig))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "signature does not match any trusted public key")
+}
+
+func TestSidecarURL(t *testing.T) {
+	for url, expected := range map[string]string{
+		"mem://app.json":                    "mem://app.json.sig",
+		"s3://bucket/app.yaml?versionId=1":  "s3://bucket/app.yaml.sig?versionId=1",
+		"git:///repo?ref=main#config.yaml":  "git:///repo?ref=main#config.yaml.sig",
+		"https://host/app.yaml?token=a#b=c": "https://host/app.yaml?token=a#b=c.sig",
+	} {
+		require.Equal(t, expected, sidecarURL(url, ".sig"), url)
+	}
+}
+
+func TestSignatureVerifier_Synthetic(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	loader, _ := newVerifyTestLoader(&SignatureVerifier{PublicKeys: []ed25519.PublicKey{pub}})
+	loader.RegisterSource(&EnvSource{})
+	dirSource := &DirSource{Loader: loader}
+	loader.RegisterSource(dirSource)
+
+	// Payloads assembled by a source have no signature of their own, so
+	// they're rejected.
+	os.Setenv("VERIFYTEST_NAME", "env")
+	defer os.Unsetenv("VERIFYTEST_NAME")
+	err = loader.LoadURL("env://VERIFYTEST", new(verifyTestConfig))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no signature to verify against")
+
+	// Directory fragments are verified one by one.
+	dir, err := ioutil.TempDir("", "configurer_")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	payload := []byte(`{"Name": "dir"}`)
+	path := filepath.Join(dir, "app.json")
+	require.NoError(t, ioutil.WriteFile(path, payload, 0644))
+	err = loader.LoadURL("dir://"+dir, new(verifyTestConfig))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "error reading signature")
+
+	require.NoError(t, ioutil.WriteFile(path+".sig", ed25519.Sign(priv, payload), 0644))
+	actCfg := new(verifyTestConfig)
+	require.NoError(t, loader.LoadURL("dir://"+dir, actCfg))
+	require.Equal(t, "dir", actCfg.Name)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"Name": "tampered"}`), 0644))
+	err = loader.LoadURL("dir://"+dir, new(verifyTestConfig))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "signature does not match any trusted public key")
+
+	// A directory read through another loader isn't verified by it.
+	otherLoader, _ := newVerifyTestLoader(&SignatureVerifier{PublicKeys: []ed25519.PublicKey{pub}})
+	otherLoader.RegisterSource(&DirSource{Loader: loader})
+	require.NoError(t, ioutil.WriteFile(path, payload, 0644))
+	err = otherLoader.LoadURL("dir://"+dir, new(verifyTestConfig))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no signature to verify against")
+}
+
+func TestDigestVerifier_Synthetic(t *testing.T) {
+	os.Setenv("VERIFYTEST_NAME", "env")
+	defer os.Unsetenv("VERIFYTEST_NAME")
+
+	loader, _ := newVerifyTestLoader(new(DigestVerifier))
+	loader.RegisterSource(&EnvSource{})
+	actCfg := new(verifyTestConfig)
+	require.NoError(t, loader.LoadURL("env://VERIFYTEST", actCfg))
+	require.Equal(t, "env", actCfg.Name)
+
+	err := loader.LoadURL("env://VERIFYTEST#sha256="+strings.Repeat("0", 64), new(verifyTestConfig))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "digests can't be checked")
+
+	loader, _ = newVerifyTestLoader(&DigestVerifier{Required: true})
+	loader.RegisterSource(&EnvSource{})
+	err = loader.LoadURL("env://VERIFYTEST", new(verifyTestConfig))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no SHA-256 digest to verify against")
+}
@@ -0,0 +1,135 @@
+package configurer
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+const XML = "xml"
+
+// XMLUnmarshaller decodes XML configs with encoding/xml, so fields are
+// matched by their xml tags. The root element corresponds to the config
+// struct, and its attributes and child elements to the struct's fields.
+//
+// The key map used for required fields and defaults has an entry for each
+// attribute and child element, keyed by local name. Elements that are
+// repeated become lists, elements with only text become strings, and the
+// text of elements that also have attributes or children is kept under
+// #text. Nested paths in tags, such as xml:"a>b", aren't matched against the
+// key map.
+type XMLUnmarshaller struct {
+}
+
+var DefaultXMLUnmarshaller = new(XMLUnmarshaller)
+
+func (x *XMLUnmarshaller) Extensions() []string {
+	return []string{XML}
+}
+
+func (x *XMLUnmarshaller) ExtractFieldName(field reflect.StructField) string {
+	tag := field.Tag.Get("xml")
+	if tag == "" {
+		return field.Name
+	}
+	tagFields := strings.Split(tag, ",")
+	name := tagFields[0]
+	for _, flag := range tagFields[1:] {
+		if flag == "chardata" {
+			return "#text"
+		}
+	}
+	// Names may be qualified by a namespace, e.g. xml:"urn:example name".
+	if spaceIdx := strings.LastIndex(name, " "); spaceIdx != -1 {
+		name = name[spaceIdx+1:]
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+func (x *XMLUnmarshaller) Unmarshal(data []byte, v interface{}) error {
+	mapPtr, ok := v.(*map[string]interface{})
+	if !ok {
+		return xml.Unmarshal(data, v)
+	}
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return fmt.Errorf("expected a root element but found none")
+		}
+		if err != nil {
+			return err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		root, err := x.element(dec, start)
+		if err != nil {
+			return err
+		}
+		keyMap, ok := root.(map[string]interface{})
+		if !ok {
+			keyMap = make(map[string]interface{})
+		}
+		*mapPtr = keyMap
+		return nil
+	}
+}
+
+// element builds the key map value of the element opened by start, consuming
+// tokens up to its end.
+func (x *XMLUnmarshaller) element(dec *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	res := make(map[string]interface{})
+	for _, attr := range start.Attr {
+		if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+			continue
+		}
+		res[attr.Name.Local] = attr.Value
+	}
+
+	var text strings.Builder
+	repeated := make(map[string]bool)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			child, err := x.element(dec, tok)
+			if err != nil {
+				return nil, err
+			}
+			name := tok.Name.Local
+			existing, exists := res[name]
+			switch {
+			case repeated[name]:
+				res[name] = append(existing.([]interface{}), child)
+			case exists:
+				res[name] = []interface{}{existing, child}
+				repeated[name] = true
+			default:
+				res[name] = child
+			}
+		case xml.CharData:
+			text.Write(tok)
+		case xml.EndElement:
+			trimmed := strings.TrimSpace(text.String())
+			if len(res) == 0 {
+				return trimmed, nil
+			}
+			if trimmed != "" {
+				res["#text"] = trimmed
+			}
+			return res, nil
+		}
+	}
+}
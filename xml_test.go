@@ -0,0 +1,87 @@
+package configurer
+
+import (
+	"encoding/xml"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestXMLUnmarshaller(t *testing.T) {
+	type backend struct {
+		Name   string `xml:"name,attr" config:"required"`
+		Weight int    `xml:"weight,attr" config:"default=1"`
+		URL    string `xml:",chardata" config:"required"`
+	}
+	type cfg struct {
+		XMLName  xml.Name `xml:"config"`
+		Version  string   `xml:"version,attr" config:"required"`
+		Name     string   `xml:"name" config:"required"`
+		Timeout  string   `xml:"timeout" config:"default=30s"`
+		Database struct {
+			Host string `xml:"host" config:"default=localhost"`
+			Port int    `xml:"port,attr"`
+		} `xml:"database"`
+		Hosts    []string  `xml:"hosts>host"`
+		Backends []backend `xml:"backend"`
+	}
+
+	keyMap := make(map[string]interface{})
+	require.NoError(t, DefaultXMLUnmarshaller.Unmarshal([]byte(`<?xml version="1.0"?>
+<config version="2" xmlns="urn:example">
+  <name>app</name>
+  <database port="5432"/>
+  <hosts><host>a</host><host>b</host></hosts>
+  <backend name="api" weight="3">http://api.internal</backend>
+</config>`), &keyMap))
+	require.Equal(t, map[string]interface{}{
+		"version":  "2",
+		"name":     "app",
+		"database": map[string]interface{}{"port": "5432"},
+		"hosts":    map[string]interface{}{"host": []interface{}{"a", "b"}},
+		"backend": map[string]interface{}{
+			"name":   "api",
+			"weight": "3",
+			"#text":  "http://api.internal",
+		},
+	}, keyMap)
+
+	loader := NewLoader()
+	loader.RegisterSource(DefaultMemorySource)
+	loader.RegisterUnmarshaller(DefaultXMLUnmarshaller)
+	DefaultMemorySource.Set("app.xml", []byte(`<config version="2">
+  <name>app</name>
+  <database port="5432"/>
+  <hosts><host>a</host><host>b</host></hosts>
+  <backend name="api" weight="3">http://api.internal</backend>
+  <backend name="auth">http://auth.internal</backend>
+</config>`))
+	defer DefaultMemorySource.Delete("app.xml")
+
+	actCfg := new(cfg)
+	require.NoError(t, loader.LoadURL("mem://app.xml", actCfg))
+	require.Equal(t, "2", actCfg.Version)
+	require.Equal(t, "app", actCfg.Name)
+	require.Equal(t, "30s", actCfg.Timeout)
+	require.Equal(t, "localhost", actCfg.Database.Host)
+	require.Equal(t, 5432, actCfg.Database.Port)
+	require.Equal(t, []string{"a", "b"}, actCfg.Hosts)
+	require.Equal(t, []backend{
+		{Name: "api", Weight: 3, URL: "http://api.internal"},
+		{Name: "auth", Weight: 1, URL: "http://auth.internal"},
+	}, actCfg.Backends)
+
+	DefaultMemorySource.Set("app.xml", []byte(`<config><name>app</name></config>`))
+	err := loader.LoadURL("mem://app.xml", new(cfg))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "required field Version not found")
+
+	DefaultMemorySource.Set("app.xml", []byte(`<config version="2"><name>app</name><backend weight="2">http://x</backend></config>`))
+	err = loader.LoadURL("mem://app.xml", new(cfg))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "required field Name not found")
+
+	DefaultMemorySource.Set("app.xml", []byte(`<config version="2"><name>app</name>`))
+	err = loader.LoadURL("mem://app.xml", new(cfg))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "error unmarshalling config")
+}